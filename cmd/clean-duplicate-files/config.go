@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/chronos-tachyon/go-dedupe/internal/config"
+)
+
+func LoadConfig() *config.Config {
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	cfg, err := config.Load(flagConfig, flagConfig != "")
+	if err != nil {
+		log.Logger.Fatal().
+			Str("path", flagConfig).
+			Err(err).
+			Msg("failed to load config file")
+		panic(nil)
+	}
+
+	set := func(name string, value string) {
+		if explicit[name] {
+			return
+		}
+		if err := flag.Set(name, value); err != nil {
+			log.Logger.Fatal().
+				Str("flag", name).
+				Str("value", value).
+				Err(err).
+				Msg("invalid value in config file")
+			panic(nil)
+		}
+	}
+
+	if cfg.Clean.Format != nil {
+		set("format", *cfg.Clean.Format)
+	}
+	if cfg.Clean.Rel != nil {
+		set("rel", strconv.FormatBool(*cfg.Clean.Rel))
+	}
+	for _, dir := range cfg.Clean.Refs {
+		set("ref", dir)
+	}
+	for _, pattern := range cfg.Clean.Prefer {
+		if err := flag.Set("prefer", pattern); err != nil {
+			log.Logger.Fatal().
+				Str("pattern", pattern).
+				Err(err).
+				Msg("invalid prefer rule in config file")
+			panic(nil)
+		}
+	}
+
+	return cfg
+}
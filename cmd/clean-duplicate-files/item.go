@@ -37,6 +37,12 @@ func Open(path string) *Item {
 }
 
 func CompareItems(a *Item, b *Item) int {
+	if a.IsRef != b.IsRef {
+		if a.IsRef {
+			return -1
+		}
+		return 1
+	}
 	order := cmp.Compare(a.Priority, b.Priority)
 	if order == 0 {
 		order = -cmp.Compare(a.Nlink, b.Nlink)
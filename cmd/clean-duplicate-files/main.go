@@ -1,7 +1,7 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"flag"
 	"io"
@@ -12,18 +12,38 @@ import (
 	"github.com/chronos-tachyon/go-autolog"
 	"github.com/rs/zerolog/log"
 
+	"github.com/chronos-tachyon/go-dedupe/internal/config"
 	"github.com/chronos-tachyon/go-dedupe/internal/glob"
+	"github.com/chronos-tachyon/go-dedupe/internal/interrupt"
+	"github.com/chronos-tachyon/go-dedupe/internal/pathutil"
+	"github.com/chronos-tachyon/go-dedupe/internal/report"
 )
 
 const tempDirPattern = ".incoming.*"
 
 var (
-	flagRel   bool
-	flagRules Rules
+	flagConfig string
+	flagRel    bool
+	flagFormat report.Format = report.FormatAuto
+	flagRules  Rules
+	flagRefs   []string
 )
 
 func init() {
+	flag.StringVar(&flagConfig, "config", "", "path to config file (default "+config.DefaultPath()+")")
 	flag.BoolVar(&flagRel, "rel", false, "use relative paths when generating symlinks")
+	flag.Func("format", "input format: auto, json, ndjson, rich, rich-ndjson, fdupes, or rmlint", func(in string) error {
+		format, err := report.ParseFormat(in)
+		if err != nil {
+			return err
+		}
+		flagFormat = format
+		return nil
+	})
+	flag.Func("ref", "directory whose files are always kept and never modified (repeatable)", func(in string) error {
+		flagRefs = append(flagRefs, pathutil.Canonical(in))
+		return nil
+	})
 	flag.Func("prefer", "glob pattern to match", func(in string) error {
 		rx, err := glob.Compile(in)
 		if err != nil {
@@ -35,6 +55,13 @@ func init() {
 }
 
 func main() {
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+
 	autolog.Init()
 	defer func() {
 		err := autolog.Done()
@@ -43,25 +70,55 @@ func main() {
 		}
 	}()
 	flag.Parse()
+	LoadConfig()
+
+	ctx, cancel := interrupt.Watch()
+	defer cancel()
 
-	raw, err := io.ReadAll(os.Stdin)
+	r, err := report.NewReader(os.Stdin, flagFormat)
 	if err != nil {
 		panic(err)
 	}
 
-	var data [][]string
-	err = json.Unmarshal(raw, &data)
-	if err != nil {
-		panic(err)
+	for ctx.Err() == nil {
+		group, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err == report.ErrIncomplete {
+			log.Logger.Warn().
+				Msg("input is incomplete because find-duplicate-files was interrupted; only the duplicates it reported were cleaned")
+			exitCode = 1
+			break
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			log.Logger.Error().
+				Err(err).
+				Msg("input ended partway through; find-duplicate-files was probably interrupted, and only the duplicates before that point were cleaned")
+			exitCode = 1
+			break
+		}
+		if err != nil {
+			panic(err)
+		}
+		processBatch(ctx, group)
 	}
 
-	for _, paths := range data {
-		processBatch(paths)
+	if ctx.Err() != nil {
+		log.Logger.Warn().
+			Msg("interrupted; remaining duplicates were not cleaned")
+		exitCode = 1
 	}
 }
 
-func processBatch(paths []string) {
-	if len(paths) <= 1 {
+func processBatch(ctx context.Context, group report.Group) {
+	if len(group.Files) <= 1 {
+		return
+	}
+	if group.Dir {
+		log.Logger.Warn().
+			Strs("paths", group.Paths()).
+			Msg("cannot clean a group of identical directories; rescan without -tree to clean the files inside them")
 		return
 	}
 
@@ -72,9 +129,28 @@ func processBatch(paths []string) {
 		}
 	}()
 
-	items = make(Items, 0, len(paths))
-	for _, path := range paths {
-		items = append(items, Open(path))
+	items = make(Items, 0, len(group.Files))
+	for _, file := range group.Files {
+		it := Open(file.Path)
+		if it == nil {
+			continue
+		}
+		if (group.Size > 0 && it.Size != group.Size) || (file.Time != 0 && it.Time != file.Time) {
+			log.Logger.Warn().
+				Str("path", it.Path).
+				Int64("oldSize", group.Size).
+				Int64("oldTime", file.Time).
+				Int64("newSize", it.Size).
+				Int64("newTime", it.Time).
+				Msg("file changed since it was scanned; skipping")
+			it.Close()
+			continue
+		}
+		it.IsRef = file.Ref || IsRefPath(it.Path)
+		items = append(items, it)
+	}
+	if len(items) <= 1 {
+		return
 	}
 	items.Sort()
 
@@ -93,7 +169,10 @@ func processBatch(paths []string) {
 	}
 
 	for _, it := range items {
-		if it == best {
+		if ctx.Err() != nil {
+			return
+		}
+		if it == best || it.IsRef {
 			continue
 		}
 		if os.SameFile(it.Info, best.Info) && !it.IsSymlink {
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/chronos-tachyon/go-dedupe/internal/pathutil"
+)
+
+// IsRefPath reports whether path lies within a -ref directory.  Only the
+// parent directory is resolved, so a symlink is judged by where it lives
+// rather than by what it points to.
+func IsRefPath(path string) bool {
+	if len(flagRefs) <= 0 {
+		return false
+	}
+	canonical := filepath.Join(pathutil.Canonical(filepath.Dir(path)), filepath.Base(path))
+	for _, dir := range flagRefs {
+		if pathutil.IsWithin(canonical, dir) {
+			return true
+		}
+	}
+	return false
+}
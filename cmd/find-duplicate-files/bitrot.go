@@ -0,0 +1,160 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/hex"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/chronos-tachyon/go-dedupe/internal/metadata"
+	"github.com/chronos-tachyon/go-dedupe/internal/report"
+)
+
+type BitrotStats struct {
+	Verified   uint
+	Corrupt    uint
+	Unverified uint
+	Failed     uint
+}
+
+// CheckBitrot rehashes every file whose stored size and mtime still match,
+// and returns the files whose contents no longer match their stored hashes.
+// Nothing is written back to the metadata store.
+func CheckBitrot(ctx context.Context, pool *Pool, entries []Entry) ([]report.BitrotFile, BitrotStats) {
+	var total int64
+	byInode := make(map[Inode]Links, len(entries))
+	for _, entry := range entries {
+		key := entry.Inode()
+		if _, found := byInode[key]; !found {
+			total += entry.Size
+		}
+		byInode[key] = append(byInode[key], entry)
+	}
+	gProgress.StartHashing(total)
+
+	var mu sync.Mutex
+	var stats BitrotStats
+	var out []report.BitrotFile
+	var wg sync.WaitGroup
+	for _, links := range byInode {
+		wg.Add(1)
+		links := links
+		slices.SortFunc(links, CompareEntries)
+		SubmitEntry(ctx, pool, &wg, links[0], func(it *Item) {
+			gProgress.SetCurrent(it.Path)
+			file, status := CheckFileBitrot(it)
+			gProgress.BytesDone(it.Size)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch status {
+			case bitrotOK:
+				stats.Verified++
+			case bitrotCorrupt:
+				stats.Corrupt++
+				for _, link := range links[1:] {
+					file.Links = append(file.Links, link.Path)
+				}
+				out = append(out, file)
+			case bitrotUnverified:
+				stats.Unverified++
+			case bitrotFailed:
+				stats.Failed++
+			}
+		})
+	}
+	wg.Wait()
+
+	slices.SortFunc(out, func(a, b report.BitrotFile) int {
+		return cmp.Compare(a.Path, b.Path)
+	})
+	return out, stats
+}
+
+type bitrotStatus uint8
+
+const (
+	bitrotOK bitrotStatus = iota
+	bitrotCorrupt
+	bitrotUnverified
+	bitrotFailed
+)
+
+func CheckFileBitrot(it *Item) (report.BitrotFile, bitrotStatus) {
+	var stored metadata.Metadata
+	gStore.Load(it, &stored)
+	if !stored.Bits.Has(metadata.SHA256Bit) || !stored.Check(it.Size, it.Time) {
+		return report.BitrotFile{}, bitrotUnverified
+	}
+
+	var actual metadata.Metadata
+	if !actual.Compute(it.File, it.Size, it.Time) {
+		return report.BitrotFile{}, bitrotFailed
+	}
+	gProgress.FileHashed(it.Size, false)
+
+	match := actual.SHA256 == stored.SHA256
+	if stored.Bits.Has(metadata.SHA1Bit) {
+		match = match && actual.SHA1 == stored.SHA1
+	}
+	if stored.Bits.Has(metadata.MD5Bit) {
+		match = match && actual.MD5 == stored.MD5
+	}
+	if match {
+		return report.BitrotFile{}, bitrotOK
+	}
+
+	log.Logger.Warn().
+		Str("path", it.Path).
+		Stringer("stored", stored).
+		Stringer("actual", actual).
+		Msg("file contents no longer match stored hashes")
+	return report.BitrotFile{
+		Path:         it.Path,
+		Dev:          it.Dev,
+		Ino:          it.Ino,
+		Size:         it.Size,
+		Time:         it.Time,
+		StoredSHA256: hex.EncodeToString(stored.SHA256[:]),
+		ActualSHA256: hex.EncodeToString(actual.SHA256[:]),
+	}, bitrotCorrupt
+}
+
+func writeBitrot(ctx context.Context, cands *Candidates) bool {
+	w, err := report.NewBitrotWriter(os.Stdout, flagFormat)
+	if err != nil {
+		log.Logger.Fatal().
+			Str("format", flagFormat.String()).
+			Err(err).
+			Msg("invalid -format for -bitrot")
+		panic(nil)
+	}
+
+	pool := NewPool(flagJobs)
+	corrupt, stats := CheckBitrot(ctx, pool, cands.Entries())
+	pool.Close()
+	gProgress.Stop()
+
+	for _, file := range corrupt {
+		if err := w.Write(file); err != nil {
+			panic(err)
+		}
+	}
+
+	event := log.Logger.Info()
+	if stats.Corrupt > 0 {
+		event = log.Logger.Error()
+	}
+	event.
+		Uint("verified", stats.Verified).
+		Uint("corrupt", stats.Corrupt).
+		Uint("unverified", stats.Unverified).
+		Uint("failed", stats.Failed).
+		Msg("bitrot check complete")
+
+	return finishOutput(ctx, w.Close, w.Abort) && stats.Corrupt == 0
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+)
+
+type Entry struct {
+	Path   string
+	Size   int64
+	Time   int64
+	Dev    uint64
+	Ino    uint64
+	Nlink  uint64
+	Blocks int64
+
+	Cached bool
+	Ref    bool
+}
+
+func NewEntry(it *Item) Entry {
+	return Entry{
+		Path:   it.Path,
+		Size:   it.Size,
+		Time:   it.Time,
+		Dev:    it.Dev,
+		Ino:    it.Ino,
+		Nlink:  it.Nlink,
+		Blocks: it.Blocks,
+	}
+}
+
+func (entry Entry) Inode() Inode {
+	return Inode{Dev: entry.Dev, Ino: entry.Ino}
+}
+
+func CompareEntries(a Entry, b Entry) int {
+	if a.Ref != b.Ref {
+		if a.Ref {
+			return -1
+		}
+		return 1
+	}
+	return cmp.Compare(a.Path, b.Path)
+}
+
+type Inode struct {
+	Dev uint64
+	Ino uint64
+}
+
+type Links []Entry
+
+type Bucket struct {
+	Size    int64
+	Entries []Entry
+}
+
+func (bucket Bucket) Inodes() []Links {
+	indexByInode := make(map[Inode]int, len(bucket.Entries))
+	out := make([]Links, 0, len(bucket.Entries))
+	for _, entry := range bucket.Entries {
+		key := entry.Inode()
+		if index, found := indexByInode[key]; found {
+			out[index] = append(out[index], entry)
+			continue
+		}
+		indexByInode[key] = len(out)
+		out = append(out, Links{entry})
+	}
+	return out
+}
+
+type pathKey struct {
+	Inode
+	Path string
+}
+
+type Candidates struct {
+	bySize map[int64][]Entry
+	byPath map[pathKey]struct{}
+	count  uint
+}
+
+func NewCandidates() *Candidates {
+	return &Candidates{
+		bySize: make(map[int64][]Entry, 1<<16),
+		byPath: make(map[pathKey]struct{}, 1<<16),
+	}
+}
+
+func (cands *Candidates) Len() uint {
+	return cands.count
+}
+
+func (cands *Candidates) Add(entry Entry) bool {
+	key := pathKey{Inode: entry.Inode(), Path: entry.Path}
+	if _, found := cands.byPath[key]; found {
+		return false
+	}
+	cands.byPath[key] = struct{}{}
+	cands.bySize[entry.Size] = append(cands.bySize[entry.Size], entry)
+	cands.count++
+	return true
+}
+
+func (cands *Candidates) Entries() []Entry {
+	out := make([]Entry, 0, cands.count)
+	for _, entries := range cands.bySize {
+		out = append(out, entries...)
+	}
+	return out
+}
+
+func (cands *Candidates) Buckets() []Bucket {
+	buckets := make([]Bucket, 0, len(cands.bySize))
+	for size, entries := range cands.bySize {
+		if len(entries) <= 1 || CountInodes(entries) <= 1 {
+			continue
+		}
+		buckets = append(buckets, Bucket{Size: size, Entries: entries})
+	}
+	slices.SortFunc(buckets, func(a, b Bucket) int {
+		return cmp.Compare(a.Size, b.Size)
+	})
+	return buckets
+}
+
+func CountInodes(entries []Entry) int {
+	inodes := make(map[Inode]struct{}, len(entries))
+	for _, entry := range entries {
+		inodes[entry.Inode()] = struct{}{}
+	}
+	return len(inodes)
+}
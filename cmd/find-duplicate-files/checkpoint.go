@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/chronos-tachyon/go-dedupe/internal/ignore"
+	"github.com/chronos-tachyon/go-dedupe/internal/pathutil"
+)
+
+const checkpointVersion = 2
+
+type Checkpoint struct {
+	Version   int
+	Roots     []string
+	Flags     CheckpointFlags
+	RootKinds map[Inode]bool
+	Pending   []PendingNode
+	Visited   map[Inode]string
+	Entries   []Entry
+	Done      []int64
+	Groups    []Group
+}
+
+// CheckpointFlags records the flags that decide which files are references
+// and what gets reported, so that a resumed run reports the same way even if
+// they are not repeated.
+type CheckpointFlags struct {
+	Refs     []string
+	UniqueIn []string
+	Against  []string
+	Tree     bool
+	Similar  bool
+	Bitrot   bool
+	Summary  bool
+	Verify   bool
+}
+
+func CurrentCheckpointFlags() CheckpointFlags {
+	return CheckpointFlags{
+		Refs:     canonicalPaths(flagRefs),
+		UniqueIn: canonicalPaths(flagUniqueIn),
+		Against:  canonicalPaths(flagAgainst),
+		Tree:     flagTree,
+		Similar:  flagSimilar,
+		Bitrot:   flagBitrot,
+		Summary:  flagSummary,
+		Verify:   flagVerify,
+	}
+}
+
+func canonicalPaths(paths []string) []string {
+	out := make([]string, len(paths))
+	for i, path := range paths {
+		out[i] = pathutil.Canonical(path)
+	}
+	return out
+}
+
+// Apply sets the recorded flags for this run.  Any of them that were given
+// again, on the command line or in the config file, must agree.
+func (saved CheckpointFlags) Apply() error {
+	current := CurrentCheckpointFlags()
+	var conflicts []string
+	flag.Visit(func(f *flag.Flag) {
+		var same bool
+		switch f.Name {
+		case "ref":
+			same = slices.Equal(current.Refs, saved.Refs)
+		case "unique-in":
+			same = slices.Equal(current.UniqueIn, saved.UniqueIn)
+		case "against":
+			same = slices.Equal(current.Against, saved.Against)
+		case "tree":
+			same = current.Tree == saved.Tree
+		case "similar":
+			same = current.Similar == saved.Similar
+		case "bitrot":
+			same = current.Bitrot == saved.Bitrot
+		case "summary":
+			same = current.Summary == saved.Summary
+		case "verify":
+			same = current.Verify == saved.Verify
+		default:
+			return
+		}
+		if !same {
+			conflicts = append(conflicts, "-"+f.Name)
+		}
+	})
+	if len(conflicts) > 0 {
+		return fmt.Errorf("flags differ from the run that wrote the checkpoint: %s; repeat them as they were, or leave them out", strings.Join(conflicts, ", "))
+	}
+
+	flagRefs = saved.Refs
+	flagUniqueIn = saved.UniqueIn
+	flagAgainst = saved.Against
+	flagTree = saved.Tree
+	flagSimilar = saved.Similar
+	flagBitrot = saved.Bitrot
+	flagSummary = saved.Summary
+	flagVerify = saved.Verify
+	return nil
+}
+
+type PendingNode struct {
+	Path       string
+	IgnoreDirs []string
+	Ref        bool
+}
+
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cp := new(Checkpoint)
+	if err := gob.NewDecoder(bufio.NewReader(f)).Decode(cp); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if cp.Version != checkpointVersion {
+		return nil, fmt.Errorf("%s: unsupported checkpoint version %d", path, cp.Version)
+	}
+	return cp, nil
+}
+
+func (cp *Checkpoint) Restore(scanner *Scanner) {
+	for key, path := range cp.Visited {
+		scanner.Visited[key] = path
+	}
+	for key, ref := range cp.RootKinds {
+		scanner.Roots[key] = ref
+	}
+	for _, entry := range cp.Entries {
+		scanner.Candidates.Add(entry)
+	}
+	for _, pending := range cp.Pending {
+		var matcher *ignore.Matcher
+		for _, dir := range pending.IgnoreDirs {
+			var err error
+			matcher, err = ignore.Load(matcher, dir, IgnoreFileNames())
+			if err != nil {
+				log.Logger.Error().
+					Str("path", dir).
+					Err(err).
+					Msg("failed to read ignore file")
+			}
+		}
+		if it := Open(pending.Path); it != nil {
+			scanner.Stack.Push(Node{Item: it, Ignore: matcher, Ref: pending.Ref})
+		}
+	}
+}
+
+type Checkpointer struct {
+	Path     string
+	Interval time.Duration
+	Roots    []string
+	Flags    CheckpointFlags
+	Scanner  *Scanner
+	Groups   []Group
+	done     map[int64]struct{}
+	last     time.Time
+}
+
+func (cp *Checkpointer) Resume(state *Checkpoint) {
+	state.Restore(cp.Scanner)
+	cp.Groups = state.Groups
+	cp.done = make(map[int64]struct{}, len(state.Done))
+	for _, size := range state.Done {
+		cp.done[size] = struct{}{}
+	}
+}
+
+func (cp *Checkpointer) MarkDone(bucket Bucket, groups []Group) {
+	if cp == nil {
+		return
+	}
+	if cp.done == nil {
+		cp.done = make(map[int64]struct{})
+	}
+	cp.done[bucket.Size] = struct{}{}
+	cp.Groups = append(cp.Groups, groups...)
+}
+
+func (cp *Checkpointer) IsDone(bucket Bucket) bool {
+	if cp == nil {
+		return false
+	}
+	_, found := cp.done[bucket.Size]
+	return found
+}
+
+func (cp *Checkpointer) Save(force bool) {
+	if cp == nil {
+		return
+	}
+	now := time.Now()
+	if !force && now.Sub(cp.last) < cp.Interval {
+		return
+	}
+	cp.last = now
+
+	scanner := cp.Scanner
+	pending := make([]PendingNode, len(scanner.Stack))
+	for i, node := range scanner.Stack {
+		pending[i] = PendingNode{Path: node.Item.Path, IgnoreDirs: node.Ignore.Dirs(), Ref: node.Ref}
+	}
+
+	done := make([]int64, 0, len(cp.done))
+	for size := range cp.done {
+		done = append(done, size)
+	}
+
+	err := cp.write(Checkpoint{
+		Version:   checkpointVersion,
+		Roots:     cp.Roots,
+		Flags:     cp.Flags,
+		RootKinds: scanner.Roots,
+		Pending:   pending,
+		Visited:   scanner.Visited,
+		Entries:   scanner.Candidates.Entries(),
+		Done:      done,
+		Groups:    cp.Groups,
+	})
+	if err != nil {
+		log.Logger.Error().
+			Str("path", cp.Path).
+			Err(err).
+			Msg("failed to write checkpoint")
+		return
+	}
+	log.Logger.Debug().
+		Str("path", cp.Path).
+		Int("pending", len(pending)).
+		Int("done", len(done)).
+		Msg("wrote checkpoint")
+}
+
+func (cp *Checkpointer) write(state Checkpoint) error {
+	dir := filepath.Dir(cp.Path)
+	f, err := os.CreateTemp(dir, filepath.Base(cp.Path)+".*")
+	if err != nil {
+		return err
+	}
+	tempPath := f.Name()
+	needRemove := true
+	defer func() {
+		if needRemove {
+			_ = os.Remove(tempPath)
+		}
+	}()
+
+	w := bufio.NewWriter(f)
+	err = gob.NewEncoder(w).Encode(state)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err == nil {
+		err = os.Rename(tempPath, cp.Path)
+	}
+	if err == nil {
+		needRemove = false
+	}
+	return err
+}
+
+func (cp *Checkpointer) Remove() {
+	if cp == nil {
+		return
+	}
+	if err := os.Remove(cp.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Logger.Error().
+			Str("path", cp.Path).
+			Err(err).
+			Msg("failed to remove checkpoint")
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/chronos-tachyon/go-dedupe/internal/config"
+)
+
+func LoadConfig() *config.Config {
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	cfg, err := config.Load(flagConfig, flagConfig != "")
+	if err != nil {
+		log.Logger.Fatal().
+			Str("path", flagConfig).
+			Err(err).
+			Msg("failed to load config file")
+		panic(nil)
+	}
+
+	set := func(name string, value string) {
+		if explicit[name] {
+			return
+		}
+		if err := flag.Set(name, value); err != nil {
+			log.Logger.Fatal().
+				Str("flag", name).
+				Str("value", value).
+				Err(err).
+				Msg("invalid value in config file")
+			panic(nil)
+		}
+	}
+	setString := func(name string, value *string) {
+		if value != nil {
+			set(name, *value)
+		}
+	}
+	setInt := func(name string, value *int64) {
+		if value != nil {
+			set(name, strconv.FormatInt(*value, 10))
+		}
+	}
+	setBool := func(name string, value *bool) {
+		if value != nil {
+			set(name, strconv.FormatBool(*value))
+		}
+	}
+
+	setString("ns", cfg.Namespace)
+	setString("format", cfg.Output.Format)
+	setInt("min-size", cfg.Scan.MinSize)
+	setInt("jobs", cfg.Scan.Jobs)
+	setBool("xdev", cfg.Scan.Xdev)
+	setString("follow", cfg.Scan.Follow)
+	setBool("gitignore", cfg.Scan.Gitignore)
+	setString("store", cfg.Scan.Store)
+	setString("cache", cfg.Scan.Cache)
+	setString("max-read-rate", cfg.Scan.MaxReadRate)
+	setBool("drop-cache", cfg.Scan.DropCache)
+	setBool("noatime", cfg.Scan.NoAtime)
+	setBool("idle-io", cfg.Scan.IdleIO)
+
+	for _, dir := range cfg.Scan.Refs {
+		set("ref", dir)
+	}
+
+	for _, rule := range cfg.Scan.Rules {
+		name := "include"
+		if rule.Exclude {
+			name = "exclude"
+		}
+		if err := flag.Set(name, rule.Pattern); err != nil {
+			log.Logger.Fatal().
+				Str("pattern", rule.Pattern).
+				Err(err).
+				Msg("invalid rule in config file")
+			panic(nil)
+		}
+	}
+
+	return cfg
+}
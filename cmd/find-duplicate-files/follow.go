@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+type FollowPolicy byte
+
+const (
+	FollowNone FollowPolicy = iota
+	FollowFiles
+	FollowAll
+)
+
+var followPolicyNames = [...]string{
+	"none",
+	"files",
+	"all",
+}
+
+func ParseFollowPolicy(input string) (FollowPolicy, error) {
+	for i, name := range followPolicyNames {
+		if strings.EqualFold(input, name) {
+			return FollowPolicy(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown symlink policy %q", input)
+}
+
+func (policy FollowPolicy) String() string {
+	return followPolicyNames[policy]
+}
+
+var _ fmt.Stringer = FollowPolicy(0)
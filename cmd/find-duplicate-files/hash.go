@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/chronos-tachyon/go-dedupe/internal/metadata"
+)
+
+func HashBuckets(ctx context.Context, pool *Pool, buckets []Bucket, emit func(Bucket, []Group)) {
+	var total int64
+	for _, bucket := range buckets {
+		total += bucket.Size * int64(CountInodes(bucket.Entries))
+	}
+	gProgress.StartHashing(total)
+
+	ForEachBucket(ctx, buckets, func(bucket Bucket) []Group {
+		return HashBucket(ctx, pool, bucket)
+	}, emit)
+}
+
+// ForEachBucket runs work on several buckets at once, but calls emit with
+// the results in bucket order.  Once ctx is cancelled, remaining buckets are
+// emitted with a zero result.
+func ForEachBucket[T any](ctx context.Context, buckets []Bucket, work func(Bucket) T, emit func(Bucket, T)) {
+	results := make([]chan T, len(buckets))
+	for i := range results {
+		results[i] = make(chan T, 1)
+	}
+
+	go func() {
+		sem := make(chan struct{}, max(flagJobs, 1))
+		for i, bucket := range buckets {
+			sem <- struct{}{}
+			go func(i int, bucket Bucket) {
+				defer func() {
+					<-sem
+				}()
+				if ctx.Err() != nil {
+					var zero T
+					results[i] <- zero
+					return
+				}
+				results[i] <- work(bucket)
+			}(i, bucket)
+		}
+	}()
+
+	for i, ch := range results {
+		emit(buckets[i], <-ch)
+	}
+}
+
+func HashBucket(ctx context.Context, pool *Pool, bucket Bucket) []Group {
+	inodes := bucket.Inodes()
+	defer gProgress.BytesDone(bucket.Size * int64(len(inodes)))
+	if flagPartialSize > 0 && bucket.Size > 2*flagPartialSize {
+		inodes = FilterByPartial(ctx, pool, inodes)
+	}
+
+	seen := NewSeen(len(bucket.Entries))
+	var wg sync.WaitGroup
+	for _, links := range inodes {
+		wg.Add(1)
+		links := links
+		SubmitEntry(ctx, pool, &wg, links[0], func(it *Item) {
+			HashFile(seen, it, links)
+		})
+	}
+	wg.Wait()
+
+	groups := seen.Groups()
+	if flagVerify {
+		groups = VerifyGroups(groups)
+	}
+	return groups
+}
+
+// FilterByPartial drops inodes that cannot be duplicates because their head
+// and tail match no other inode.  Inodes that already have a valid memoized
+// full hash are kept without reading them; an unread inode is only dropped if
+// it cannot match one of those either.
+func FilterByPartial(ctx context.Context, pool *Pool, inodes []Links) []Links {
+	var mu sync.Mutex
+	var memoized, rest []Links
+	memoPartials := make(map[SHA256Sum]struct{})
+	memoUnknown := false
+
+	var wg sync.WaitGroup
+	for _, links := range inodes {
+		wg.Add(1)
+		links := links
+		SubmitEntry(ctx, pool, &wg, links[0], func(it *Item) {
+			if !HasMemoizedHash(it) {
+				mu.Lock()
+				rest = append(rest, links)
+				mu.Unlock()
+				return
+			}
+			hash, known := CachedPartialHash(it)
+			mu.Lock()
+			memoized = append(memoized, links)
+			if known {
+				memoPartials[hash] = struct{}{}
+			} else {
+				memoUnknown = true
+			}
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+
+	out := memoized
+	for hash, class := range partialClasses(ctx, pool, rest) {
+		_, matchesMemoized := memoPartials[hash]
+		if len(class) > 1 || matchesMemoized || memoUnknown {
+			out = append(out, class...)
+		}
+	}
+	return out
+}
+
+func PartialClasses(ctx context.Context, pool *Pool, inodes []Links) [][]Links {
+	byPartial := partialClasses(ctx, pool, inodes)
+	out := make([][]Links, 0, len(byPartial))
+	for _, class := range byPartial {
+		out = append(out, class)
+	}
+	return out
+}
+
+func partialClasses(ctx context.Context, pool *Pool, inodes []Links) map[SHA256Sum][]Links {
+	var mu sync.Mutex
+	byPartial := make(map[SHA256Sum][]Links, len(inodes))
+
+	var wg sync.WaitGroup
+	for _, links := range inodes {
+		wg.Add(1)
+		links := links
+		SubmitEntry(ctx, pool, &wg, links[0], func(it *Item) {
+			hash, ok := PartialHashFile(it)
+			if !ok {
+				return
+			}
+			mu.Lock()
+			byPartial[hash] = append(byPartial[hash], links)
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+	return byPartial
+}
+
+func SubmitEntry(ctx context.Context, pool *Pool, wg *sync.WaitGroup, entry Entry, fn func(*Item)) {
+	pool.Submit(func() {
+		defer wg.Done()
+		if ctx.Err() != nil {
+			return
+		}
+		it := Open(entry.Path)
+		if it == nil {
+			return
+		}
+		defer it.Close()
+		fn(it)
+	})
+}
+
+// HasMemoizedHash reports whether HashFile would reuse its stored hashes
+// rather than reading the file.
+func HasMemoizedHash(it *Item) bool {
+	if flagRescan {
+		return false
+	}
+	var meta metadata.Metadata
+	return gStore.Load(it, &meta) && meta.Check(it.Size, it.Time)
+}
+
+func CachedPartialHash(it *Item) (SHA256Sum, bool) {
+	var partial metadata.Partial
+	if flagPartialCache && !flagRescan {
+		if partial.Load(it.File, gNames.Partial) && partial.Check(it.Size, it.Time, flagPartialSize) {
+			return partial.SHA256, true
+		}
+	}
+	return SHA256Sum{}, false
+}
+
+func PartialHashFile(it *Item) (SHA256Sum, bool) {
+	if hash, ok := CachedPartialHash(it); ok {
+		return hash, true
+	}
+
+	var partial metadata.Partial
+	if !partial.Compute(it.File, it.Size, it.Time, flagPartialSize) {
+		return SHA256Sum{}, false
+	}
+
+	if flagPartialCache && gWriteXattrs {
+		partial.Save(it.File, gNames.Partial)
+	}
+	return partial.SHA256, true
+}
+
+func HashFile(seen *Seen, it *Item, links Links) {
+	gProgress.SetCurrent(it.Path)
+
+	var meta metadata.Metadata
+	hasAll := gStore.Load(it, &meta)
+
+	needRescan := flagRescan
+	if !needRescan && !hasAll {
+		log.Logger.Info().
+			Str("path", it.Path).
+			Str("reason", "missing metadata").
+			Stringer("bitsFound", meta.Bits).
+			Stringer("bitsMissing", metadata.AllBits&^meta.Bits).
+			Msg("hash file")
+		needRescan = true
+	}
+	if !needRescan && !meta.Check(it.Size, it.Time) {
+		log.Logger.Info().
+			Str("path", it.Path).
+			Str("reason", "outdated metadata").
+			Int64("oldSize", meta.Size).
+			Int64("oldTime", meta.Time).
+			Int64("newSize", it.Size).
+			Int64("newTime", it.Time).
+			Msg("hash file")
+		needRescan = true
+	}
+	if needRescan {
+		hasAll = meta.Compute(it.File, it.Size, it.Time)
+	}
+	gProgress.FileHashed(it.Size, !needRescan)
+	if !hasAll {
+		return
+	}
+
+	gStore.Save(it, meta)
+
+	entry := NewEntry(it)
+	entry.Cached = !needRescan
+	entry.Ref = links[0].Ref
+	seen.Add(meta, entry)
+	for _, link := range links[1:] {
+		link.Cached = entry.Cached
+		seen.Add(meta, link)
+	}
+}
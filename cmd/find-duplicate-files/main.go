@@ -1,44 +1,177 @@
 package main
 
 import (
-	"bufio"
-	"encoding/json"
+	"context"
 	"flag"
-	"io/fs"
+	"fmt"
+	"io"
 	"os"
-	"path/filepath"
+	"runtime"
+	"slices"
+	"time"
 
 	"github.com/chronos-tachyon/go-autolog"
 	"github.com/rs/zerolog/log"
 
+	"github.com/chronos-tachyon/go-dedupe/internal/chunk"
+	"github.com/chronos-tachyon/go-dedupe/internal/config"
 	"github.com/chronos-tachyon/go-dedupe/internal/glob"
+	"github.com/chronos-tachyon/go-dedupe/internal/interrupt"
+	"github.com/chronos-tachyon/go-dedupe/internal/item"
 	"github.com/chronos-tachyon/go-dedupe/internal/metadata"
+	"github.com/chronos-tachyon/go-dedupe/internal/report"
 	"github.com/chronos-tachyon/go-dedupe/internal/stack"
+	"github.com/chronos-tachyon/go-dedupe/internal/throttle"
 )
 
 type (
 	MD5Sum    = metadata.MD5Sum
 	SHA1Sum   = metadata.SHA1Sum
 	SHA256Sum = metadata.SHA256Sum
-	Stack     = stack.Stack[*Item]
+	Stack     = stack.Stack[Node]
 )
 
 var (
 	flagXdev    bool
 	flagRescan  bool
 	flagRewrite bool
+	flagVerify  bool
 	flagMinSize int64
+	flagJobs    int
+	flagFollow  FollowPolicy = FollowFiles
 	flagNS      string
+	flagFormat  report.Format = report.FormatJSON
 	flagRules   Rules
+	flagRefs    []string
+
+	flagGitignore bool
+	flagConfig    string
+
+	flagPartialSize  int64
+	flagPartialCache bool
+
+	flagStore     metadata.StoreKind = metadata.XattrStoreKind
+	flagCachePath string
+	flagNoWrite   bool
+	flagCacheOnly bool
+
+	flagProgress         bool
+	flagProgressInterval time.Duration
+
+	flagCheckpoint         string
+	flagCheckpointInterval time.Duration
+	flagResume             bool
+
+	flagMaxReadRate int64
+	flagDropCache   bool
+	flagNoAtime     bool
+	flagIdleIO      bool
+
+	flagTree bool
+
+	flagSimilar      bool
+	flagSimilarRatio float64
+	flagChunkSize    int
+
+	flagUniqueIn []string
+	flagAgainst  []string
+
+	flagSummary bool
+	flagTop     int
+
+	flagBitrot bool
 )
 
-var gNames metadata.Names = metadata.DefaultNames()
+var (
+	gNames metadata.Names = metadata.DefaultNames()
+	gStore metadata.Store
+
+	gWriteXattrs bool
+
+	gRewriteStats metadata.RewriteStats
+	gRewriteFiles uint
+
+	gProgress   *Progress
+	gCheckpoint *Checkpointer
+)
 
 func init() {
+	flag.StringVar(&flagConfig, "config", "", "path to config file (default "+config.DefaultPath()+")")
 	flag.BoolVar(&flagXdev, "xdev", false, "don't recurse into different filesystems")
 	flag.BoolVar(&flagRescan, "rescan", false, "don't trust memoized hashes at all")
+	flag.BoolVar(&flagRewrite, "rewrite", false, "rewrite memoized hashes in xattrs in canonical form, removing malformed values")
+	flag.BoolVar(&flagVerify, "verify", false, "compare file contents byte for byte before reporting duplicates")
+	flag.Func("follow", "which symlinks to follow: none, files, or all", func(in string) error {
+		policy, err := ParseFollowPolicy(in)
+		if err != nil {
+			return err
+		}
+		flagFollow = policy
+		return nil
+	})
+	flag.BoolVar(&flagGitignore, "gitignore", false, "also honour .gitignore files, in addition to "+dedupeIgnoreName)
 	flag.Int64Var(&flagMinSize, "min-size", 1, "don't scan files with fewer bytes than this")
+	flag.IntVar(&flagJobs, "jobs", runtime.NumCPU(), "number of files to hash in parallel")
+	flag.Int64Var(&flagPartialSize, "partial-size", 4096, "bytes to hash from each end of a file before hashing it fully (0 to disable)")
+	flag.BoolVar(&flagPartialCache, "partial-cache", false, "memoize partial hashes in xattrs")
 	flag.StringVar(&flagNS, "ns", "user.dedupe.", "xattr namespace to use")
+	flag.Func("store", "where to memoize hashes: xattr, cache, or both (xattr with cache fallback)", func(in string) error {
+		kind, err := metadata.ParseStoreKind(in)
+		if err != nil {
+			return err
+		}
+		flagStore = kind
+		return nil
+	})
+	flag.StringVar(&flagCachePath, "cache", metadata.DefaultCachePath(), "path to the metadata cache file for -store=cache or -store=both")
+	flag.BoolVar(&flagNoWrite, "no-write", false, "use memoized hashes but never write xattrs or the metadata cache")
+	flag.BoolVar(&flagCacheOnly, "cache-only", false, "use memoized hashes but write new ones only to the metadata cache, never to xattrs")
+	flag.BoolVar(&flagProgress, "progress", false, "report progress on stderr (a status line on a terminal, periodic log events otherwise)")
+	flag.DurationVar(&flagProgressInterval, "progress-interval", 10*time.Second, "how often to log progress events when stderr is not a terminal")
+	flag.StringVar(&flagCheckpoint, "checkpoint", "", "periodically save scan state to this file so that an interrupted scan can be resumed")
+	flag.DurationVar(&flagCheckpointInterval, "checkpoint-interval", time.Minute, "how often to save the -checkpoint file")
+	flag.BoolVar(&flagResume, "resume", false, "continue from the -checkpoint file, if it exists")
+	flag.Func("max-read-rate", "limit total read bandwidth, in bytes per second (K, M, G suffixes allowed; 0 for no limit)", func(in string) error {
+		rate, err := throttle.ParseRate(in)
+		if err != nil {
+			return err
+		}
+		flagMaxReadRate = rate
+		return nil
+	})
+	flag.BoolVar(&flagDropCache, "drop-cache", false, "evict each file from the page cache after reading it")
+	flag.BoolVar(&flagNoAtime, "noatime", false, "don't update access times when opening files (Linux, own files only)")
+	flag.BoolVar(&flagIdleIO, "idle-io", false, "run in the idle I/O scheduling class (Linux)")
+	flag.BoolVar(&flagTree, "tree", false, "report identical directory trees as a whole instead of the duplicate files inside them")
+	flag.BoolVar(&flagSimilar, "similar", false, "report pairs of files that share most of their content, instead of exact duplicates")
+	flag.Float64Var(&flagSimilarRatio, "similar-ratio", 0.5, "minimum fraction of the larger file's bytes that must be shared for -similar")
+	flag.IntVar(&flagChunkSize, "chunk-size", 8192, "average content-defined chunk size in bytes for -similar")
+	flag.BoolVar(&flagSummary, "summary", false, "report totals and the biggest offenders instead of the duplicate groups themselves")
+	flag.IntVar(&flagTop, "top", 10, "number of directories and extensions to list in the -summary")
+	flag.BoolVar(&flagBitrot, "bitrot", false, "rehash files whose size and mtime match their stored hashes, and report any whose contents have changed")
+	flag.Func("format", "output format: json, ndjson, rich, rich-ndjson, fdupes, or rmlint", func(in string) error {
+		format, err := report.ParseFormat(in)
+		if err != nil {
+			return err
+		}
+		if format == report.FormatAuto {
+			return fmt.Errorf("format %q is not supported for output", format)
+		}
+		flagFormat = format
+		return nil
+	})
+	flag.Func("ref", "directory to compare against without ever reporting its files for cleanup (repeatable)", func(in string) error {
+		flagRefs = append(flagRefs, in)
+		return nil
+	})
+	flag.Func("unique-in", "list files under this root with no identical copy under any -against root (repeatable)", func(in string) error {
+		flagUniqueIn = append(flagUniqueIn, in)
+		return nil
+	})
+	flag.Func("against", "root to search for copies of -unique-in files (repeatable)", func(in string) error {
+		flagAgainst = append(flagAgainst, in)
+		return nil
+	})
 	flag.Func("include", "glob pattern to include", func(in string) error {
 		rx, err := glob.Compile(in)
 		if err != nil {
@@ -58,6 +191,13 @@ func init() {
 }
 
 func main() {
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+
 	autolog.Init()
 	defer func() {
 		err := autolog.Done()
@@ -66,194 +206,368 @@ func main() {
 		}
 	}()
 	flag.Parse()
+	cfg := LoadConfig()
 	gNames.Stamp = flagNS + "stamp"
+	gNames.Partial = flagNS + "partial"
+	gNames = cfg.Names.Apply(gNames)
 
-	stack := make(Stack, 0, 256)
+	var resumed *Checkpoint
+	if flagResume {
+		if flagCheckpoint == "" {
+			log.Logger.Fatal().
+				Msg("-resume requires -checkpoint")
+			panic(nil)
+		}
+		var err error
+		resumed, err = LoadCheckpoint(flagCheckpoint)
+		if err != nil {
+			log.Logger.Fatal().
+				Str("path", flagCheckpoint).
+				Err(err).
+				Msg("failed to read checkpoint")
+			panic(nil)
+		}
+		if resumed != nil {
+			if err := resumed.Flags.Apply(); err != nil {
+				log.Logger.Fatal().
+					Str("path", flagCheckpoint).
+					Err(err).
+					Msg("cannot resume with different flags")
+				panic(nil)
+			}
+		}
+	}
+	checkFlags()
+
+	throttle.SetMaxReadRate(flagMaxReadRate)
+	throttle.SetDropCache(flagDropCache)
+	item.NoAtime = flagNoAtime
+	if flagIdleIO {
+		if err := throttle.SetIdlePriority(); err != nil {
+			log.Logger.Warn().
+				Err(err).
+				Msg("failed to set idle I/O priority")
+		}
+	}
+
+	storeOpts := metadata.StoreOptions{
+		Kind:      flagStore,
+		Names:     gNames,
+		CachePath: flagCachePath,
+		NoWrite:   flagNoWrite,
+		CacheOnly: flagCacheOnly,
+	}
+	gWriteXattrs = storeOpts.WritesXattrs()
+	if flagRewrite && !gWriteXattrs {
+		log.Logger.Fatal().
+			Msg("-rewrite requires writable xattrs; it cannot be combined with -no-write, -cache-only, or -store=cache")
+		panic(nil)
+	}
+
+	var err error
+	gStore, err = metadata.OpenStore(storeOpts)
+	if err != nil {
+		log.Logger.Fatal().
+			Str("store", flagStore.String()).
+			Err(err).
+			Msg("failed to open metadata store")
+		panic(nil)
+	}
 	defer func() {
-		for !stack.IsEmpty() {
-			stack.Pop().Close()
+		if err := gStore.Close(); err != nil {
+			log.Logger.Error().
+				Str("store", flagStore.String()).
+				Err(err).
+				Msg("failed to close metadata store")
 		}
 	}()
 
-	for _, rootPath := range flag.Args() {
-		if it := Open(filepath.Clean(rootPath)); it != nil {
-			stack.Push(it)
-		}
+	ctx, cancel := interrupt.Watch()
+	defer cancel()
+
+	if flagProgress {
+		gProgress = StartProgress(flagProgressInterval)
 	}
 
-	seen := make(map[SHA256Sum][]string, 1<<20)
-	for !stack.IsEmpty() {
-		Scan(&stack, seen, stack.Pop())
+	scanner := NewScanner()
+	defer scanner.Close()
+
+	rootArgs, refArgs := flag.Args(), flagRefs
+	if len(flagUniqueIn) > 0 {
+		if len(rootArgs) > 0 || len(flagAgainst) <= 0 {
+			log.Logger.Fatal().
+				Msg("-unique-in requires -against and takes no other root arguments")
+			panic(nil)
+		}
+		rootArgs = flagUniqueIn
+		refArgs = append(refArgs[:len(refArgs):len(refArgs)], flagAgainst...)
 	}
 
-	hashes := make(SHA256List, 0, len(seen))
-	for hash := range seen {
-		hashes = append(hashes, hash)
+	roots := CanonicalRoots(rootArgs, refArgs)
+	rootPaths := make([]string, len(roots))
+	for i, root := range roots {
+		rootPaths[i] = root.Canonical
 	}
-	hashes.Sort()
 
-	results := make([][]string, 0, len(hashes))
-	for _, hash := range hashes {
-		paths := seen[hash]
-		if len(paths) <= 1 {
-			continue
+	if flagCheckpoint != "" {
+		gCheckpoint = &Checkpointer{
+			Path:     flagCheckpoint,
+			Interval: flagCheckpointInterval,
+			Roots:    rootPaths,
+			Flags:    CurrentCheckpointFlags(),
+			Scanner:  scanner,
 		}
-		results = append(results, paths)
 	}
 
-	stdout := bufio.NewWriter(os.Stdout)
-	e := json.NewEncoder(stdout)
-	e.SetEscapeHTML(false)
-	e.SetIndent("", "  ")
-	if err := e.Encode(results); err != nil {
-		panic(err)
+	if resumed != nil && len(rootArgs) > 0 && !slices.Equal(resumed.Roots, rootPaths) {
+		log.Logger.Fatal().
+			Str("path", flagCheckpoint).
+			Strs("checkpointRoots", resumed.Roots).
+			Strs("roots", rootPaths).
+			Msg("checkpoint was written for different roots")
+		panic(nil)
 	}
-	if err := stdout.Flush(); err != nil {
-		panic(err)
+
+	if resumed != nil {
+		gCheckpoint.Roots = resumed.Roots
+		gCheckpoint.Resume(resumed)
+		log.Logger.Info().
+			Str("path", flagCheckpoint).
+			Int("pending", len(resumed.Pending)).
+			Int("files", len(resumed.Entries)).
+			Int("done", len(resumed.Done)).
+			Msg("resuming from checkpoint")
+	} else {
+		for _, path := range rootArgs {
+			scanner.MarkRoot(path, false)
+		}
+		for _, path := range refArgs {
+			scanner.MarkRoot(path, true)
+		}
+		for _, root := range roots {
+			scanner.AddRoot(root.Path, root.Ref)
+		}
 	}
-}
+	scanner.Run(ctx)
+	if ctx.Err() == nil {
+		gCheckpoint.Save(true)
+	}
+
+	cands := scanner.Candidates
+	buckets := slices.DeleteFunc(cands.Buckets(), gCheckpoint.IsDone)
+	log.Logger.Info().
+		Uint("files", cands.Len()).
+		Int("sizes", len(buckets)).
+		Msg("scan complete")
 
-func Scan(stack *Stack, seen map[SHA256Sum][]string, it *Item) {
-	defer it.Close()
-	switch it.Mode.Type() {
-	case 0:
-		ScanFile(seen, it)
-	case fs.ModeDir:
-		ScanDir(stack, seen, it)
+	if flagRewrite {
+		log.Logger.Info().
+			Uint("files", gRewriteFiles).
+			Uint("changed", gRewriteStats.Changed).
+			Uint("removed", gRewriteStats.Removed).
+			Msg("rewrite complete")
 	}
-}
 
-func ScanDir(stack *Stack, seen map[SHA256Sum][]string, it *Item) {
-	if flagRules.Exclude(it) {
+	if flagSimilar {
+		if !writeSimilar(ctx, cands) {
+			exitCode = 1
+		}
 		return
 	}
 
-	log.Logger.Debug().
-		Str("path", it.Path).
-		Msg("scan directory")
+	if flagBitrot {
+		if !writeBitrot(ctx, cands) {
+			exitCode = 1
+		}
+		return
+	}
 
-	dents, err := it.File.ReadDir(-1)
-	if err != nil {
-		log.Logger.Error().
-			Str("path", it.Path).
-			Err(err).
-			Msg("failed to read directory")
+	if len(flagUniqueIn) > 0 {
+		if !writeUnique(ctx, cands) {
+			exitCode = 1
+		}
 		return
 	}
 
-	var child *Item
-	for _, dent := range dents {
-		fileName := dent.Name()
-		if fileName == "." || fileName == ".." {
-			continue
-		}
-
-		filePath := filepath.Join(it.Path, fileName)
-		fileType := dent.Type()
-		switch fileType {
-		case 0:
-			// pass
-		case fs.ModeDir:
-			// pass
-		case fs.ModeSymlink:
-			targetInfo, err := os.Stat(filePath)
-			if err != nil {
-				continue
-			}
-			if targetType := targetInfo.Mode().Type(); targetType != 0 {
-				continue
+	var w report.Writer
+	var sw *report.SummaryWriter
+	if flagSummary {
+		sw, err = report.NewSummaryWriter(os.Stdout, flagFormat)
+		if err != nil {
+			log.Logger.Fatal().
+				Str("format", flagFormat.String()).
+				Err(err).
+				Msg("invalid -format for -summary")
+			panic(nil)
+		}
+	} else {
+		w, err = report.NewWriter(os.Stdout, flagFormat, len(flagRefs) > 0)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	var results []Group
+	emit := func(groups []Group) {
+		if !flagFormat.Streaming() || flagTree || flagSummary {
+			results = append(results, groups...)
+			return
+		}
+		for _, group := range groups {
+			if err := w.Write(group.Report()); err != nil {
+				panic(err)
 			}
-			fileType = 0
-		default:
-			continue
 		}
+	}
+	if resumed != nil {
+		emit(resumed.Groups)
+	}
 
-		child.Close()
-		child = Open(filePath)
-		if child == nil {
-			continue
+	pool := NewPool(flagJobs)
+	HashBuckets(ctx, pool, buckets, func(bucket Bucket, groups []Group) {
+		emit(groups)
+		if ctx.Err() == nil {
+			gCheckpoint.MarkDone(bucket, groups)
+			gCheckpoint.Save(false)
 		}
-		fileType2 := child.Mode.Type()
+	})
+	pool.Close()
+	gProgress.Stop()
 
-		if child.Dev != it.Dev {
-			if flagXdev {
-				continue
-			}
-			if fileType != fileType2 {
-				continue
-			}
+	if flagSummary {
+		summary := Summarize(results, flagTop)
+		summary.Incomplete = ctx.Err() != nil
+		if err := sw.Write(summary); err != nil {
+			panic(err)
 		}
+		if !finishOutput(ctx, nil, nil) {
+			exitCode = 1
+		}
+		return
+	}
 
-		if fileType != fileType2 {
-			log.Logger.Error().
-				Str("path", child.Path).
-				Stringer("readDirType", fileType).
-				Stringer("statType", fileType2).
-				Msg("file type mismatch")
-			continue
+	if flagTree {
+		var dirGroups []DirGroup
+		dirGroups, results = FindDuplicateTrees(scanner.Visited, cands.Entries(), results)
+		for _, dg := range dirGroups {
+			if err := w.Write(dg.Report()); err != nil {
+				panic(err)
+			}
 		}
+	}
 
-		if fileType == fs.ModeDir {
-			stack.Push(child)
-			child = nil
-			continue
+	slices.SortFunc(results, CompareGroups)
+	for _, group := range results {
+		if err := w.Write(group.Report()); err != nil {
+			panic(err)
 		}
+	}
 
-		ScanFile(seen, child)
+	if !finishOutput(ctx, w.Close, w.Abort) {
+		exitCode = 1
 	}
-	child.Close()
 }
 
-func ScanFile(seen map[SHA256Sum][]string, it *Item) {
-	if it.Size < flagMinSize {
-		return
+// checkFlags rejects conflicting modes, and output formats that the chosen
+// mode cannot write, before any time is spent scanning.
+func checkFlags() {
+	var modes []string
+	if flagSimilar {
+		modes = append(modes, "-similar")
 	}
-	if flagRules.Exclude(it) {
-		return
+	if flagBitrot {
+		modes = append(modes, "-bitrot")
 	}
-
-	log.Logger.Debug().
-		Str("path", it.Path).
-		Msg("scan file")
-
-	var meta metadata.Metadata
-	hasAll := meta.Load(it.File, gNames)
-
-	needRescan := flagRescan
-	if !needRescan && !hasAll {
-		log.Logger.Info().
-			Str("path", it.Path).
-			Str("reason", "missing metadata").
-			Stringer("bitsFound", meta.Bits).
-			Stringer("bitsMissing", metadata.AllBits&^meta.Bits).
-			Msg("hash file")
-		needRescan = true
-	}
-	if !needRescan && !meta.Check(it.Size, it.Time) {
-		log.Logger.Info().
-			Str("path", it.Path).
-			Str("reason", "outdated metadata").
-			Int64("oldSize", meta.Size).
-			Int64("oldTime", meta.Time).
-			Int64("newSize", it.Size).
-			Int64("newTime", it.Time).
-			Msg("hash file")
-		needRescan = true
-	}
-	if needRescan {
-		hasAll = meta.Compute(it.File, it.Size, it.Time)
-	}
-	if !hasAll {
-		return
+	if len(flagUniqueIn) > 0 {
+		modes = append(modes, "-unique-in")
+	}
+	if flagSummary {
+		modes = append(modes, "-summary")
+	}
+	if flagTree {
+		modes = append(modes, "-tree")
+	}
+	if len(modes) > 1 {
+		log.Logger.Fatal().
+			Strs("modes", modes).
+			Msg("only one of -similar, -bitrot, -unique-in, -summary, or -tree may be given")
+		panic(nil)
+	}
+	if flagVerify && (flagSimilar || flagBitrot || len(flagUniqueIn) > 0) {
+		log.Logger.Fatal().
+			Strs("modes", modes).
+			Msg("-verify only applies to duplicate groups; it cannot be combined with -similar, -bitrot, or -unique-in")
+		panic(nil)
+	}
+	if len(flagAgainst) > 0 && len(flagUniqueIn) <= 0 {
+		log.Logger.Fatal().
+			Msg("-against requires -unique-in")
+		panic(nil)
 	}
 
-	meta.Save(it.File, gNames)
+	var err error
+	switch {
+	case flagSimilar:
+		if _, err := chunk.NewParams(flagChunkSize); err != nil {
+			log.Logger.Fatal().
+				Int("chunkSize", flagChunkSize).
+				Err(err).
+				Msg("invalid -chunk-size")
+			panic(nil)
+		}
+		_, err = report.NewPairWriter(io.Discard, flagFormat)
+	case flagBitrot:
+		_, err = report.NewBitrotWriter(io.Discard, flagFormat)
+	case len(flagUniqueIn) > 0:
+		_, err = report.NewUniqueWriter(io.Discard, flagFormat)
+	case flagSummary:
+		_, err = report.NewSummaryWriter(io.Discard, flagFormat)
+	case flagFormat.Annotated():
+		// pass
+	case len(flagRefs) > 0:
+		log.Logger.Fatal().
+			Str("format", flagFormat.String()).
+			Msg("-ref requires -format=rich, rich-ndjson, or rmlint; other formats cannot mark reference files, so clean-duplicate-files would modify them")
+		panic(nil)
+	case flagTree:
+		log.Logger.Fatal().
+			Str("format", flagFormat.String()).
+			Msg("-tree requires -format=rich, rich-ndjson, or rmlint; other formats cannot tell directory groups from file groups")
+		panic(nil)
+	}
+	if err != nil {
+		log.Logger.Fatal().
+			Str("format", flagFormat.String()).
+			Err(err).
+			Msg("invalid -format for " + modes[0])
+		panic(nil)
+	}
+}
 
-	hash := meta.SHA256
-	list := seen[hash]
-	if list == nil {
-		list = make([]string, 0, 1)
+// finishOutput closes the output and removes the checkpoint, unless the run
+// was interrupted, in which case it saves the checkpoint, aborts the output,
+// and returns false.
+func finishOutput(ctx context.Context, closeFn func() error, abortFn func() error) bool {
+	if ctx.Err() != nil {
+		gCheckpoint.Save(true)
+		log.Logger.Warn().
+			Msg("interrupted; results are incomplete")
+		if abortFn != nil {
+			if err := abortFn(); err != nil {
+				panic(err)
+			}
+		}
+		if flagFormat == report.FormatFdupes {
+			log.Logger.Warn().
+				Msg("fdupes output cannot be marked incomplete, so no results were written")
+		}
+		return false
+	}
+	if closeFn != nil {
+		if err := closeFn(); err != nil {
+			panic(err)
+		}
 	}
-	list = append(list, it.Path)
-	seen[hash] = list
+	gCheckpoint.Remove()
+	return true
 }
@@ -0,0 +1,36 @@
+package main
+
+import "sync"
+
+type Pool struct {
+	wg    sync.WaitGroup
+	queue chan func()
+}
+
+func NewPool(jobs int) *Pool {
+	if jobs < 1 {
+		jobs = 1
+	}
+	pool := &Pool{queue: make(chan func(), jobs)}
+	pool.wg.Add(jobs)
+	for i := 0; i < jobs; i++ {
+		go pool.worker()
+	}
+	return pool
+}
+
+func (pool *Pool) worker() {
+	defer pool.wg.Done()
+	for fn := range pool.queue {
+		fn()
+	}
+}
+
+func (pool *Pool) Submit(fn func()) {
+	pool.queue <- fn
+}
+
+func (pool *Pool) Close() {
+	close(pool.queue)
+	pool.wg.Wait()
+}
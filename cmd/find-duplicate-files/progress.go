@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mattn/go-isatty"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	progressTTYInterval = 250 * time.Millisecond
+	progressPathWidth   = 60
+)
+
+type Progress struct {
+	start     time.Time
+	hashStart atomic.Int64
+
+	filesSeen   atomic.Int64
+	bytesSeen   atomic.Int64
+	filesHashed atomic.Int64
+	bytesHashed atomic.Int64
+	cacheHits   atomic.Int64
+	cacheMisses atomic.Int64
+	bytesDone   atomic.Int64
+	bytesTotal  atomic.Int64
+	current     atomic.Pointer[string]
+
+	isTTY bool
+	stop  chan struct{}
+	wg    sync.WaitGroup
+}
+
+func StartProgress(interval time.Duration) *Progress {
+	p := &Progress{
+		start: time.Now(),
+		isTTY: isatty.IsTerminal(os.Stderr.Fd()),
+		stop:  make(chan struct{}),
+	}
+	p.bytesTotal.Store(-1)
+	if p.isTTY {
+		interval = progressTTYInterval
+	}
+	p.wg.Add(1)
+	go p.loop(interval)
+	return p
+}
+
+func (p *Progress) loop(interval time.Duration) {
+	defer p.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.render(false)
+		}
+	}
+}
+
+func (p *Progress) Stop() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	p.wg.Wait()
+	p.render(true)
+}
+
+func (p *Progress) SetCurrent(path string) {
+	if p == nil {
+		return
+	}
+	p.current.Store(&path)
+}
+
+func (p *Progress) FileSeen(size int64) {
+	if p == nil {
+		return
+	}
+	p.filesSeen.Add(1)
+	p.bytesSeen.Add(size)
+}
+
+func (p *Progress) StartHashing(totalBytes int64) {
+	if p == nil {
+		return
+	}
+	p.hashStart.Store(time.Now().UnixNano())
+	p.bytesTotal.Store(totalBytes)
+}
+
+func (p *Progress) FileHashed(size int64, cached bool) {
+	if p == nil {
+		return
+	}
+	if cached {
+		p.cacheHits.Add(1)
+		return
+	}
+	p.cacheMisses.Add(1)
+	p.filesHashed.Add(1)
+	p.bytesHashed.Add(size)
+}
+
+func (p *Progress) BytesDone(n int64) {
+	if p == nil {
+		return
+	}
+	p.bytesDone.Add(n)
+}
+
+func (p *Progress) eta(now time.Time) (time.Duration, bool) {
+	total := p.bytesTotal.Load()
+	hashStart := p.hashStart.Load()
+	done := p.bytesDone.Load()
+	if total < 0 || hashStart == 0 || done <= 0 {
+		return 0, false
+	}
+	elapsed := now.Sub(time.Unix(0, hashStart))
+	remaining := float64(total-done) / float64(done) * float64(elapsed)
+	return time.Duration(remaining).Round(time.Second), true
+}
+
+func (p *Progress) render(final bool) {
+	now := time.Now()
+	elapsed := now.Sub(p.start)
+	bytesHashed := p.bytesHashed.Load()
+	rate := float64(bytesHashed) / elapsed.Seconds()
+
+	hits, misses := p.cacheHits.Load(), p.cacheMisses.Load()
+	hitRate := 0.0
+	if hits+misses > 0 {
+		hitRate = float64(hits) / float64(hits+misses)
+	}
+
+	var current string
+	if ptr := p.current.Load(); ptr != nil {
+		current = *ptr
+	}
+
+	eta, hasETA := p.eta(now)
+
+	if !p.isTTY {
+		event := log.Logger.Info().
+			Int64("filesSeen", p.filesSeen.Load()).
+			Int64("bytesSeen", p.bytesSeen.Load()).
+			Int64("filesHashed", p.filesHashed.Load()).
+			Int64("bytesHashed", bytesHashed).
+			Float64("cacheHitRate", hitRate).
+			Float64("bytesPerSecond", rate).
+			Str("path", current)
+		if hasETA {
+			event = event.
+				Int64("bytesTotal", p.bytesTotal.Load()).
+				Dur("eta", eta)
+		}
+		event.Msg("progress")
+		return
+	}
+
+	var buf strings.Builder
+	buf.WriteString("\r\x1b[K")
+	if final {
+		fmt.Fprintf(&buf, "done in %v: ", elapsed.Round(time.Second))
+	}
+	fmt.Fprintf(&buf, "seen %d files (%s), hashed %d files (%s, %s/s), cache %.0f%%",
+		p.filesSeen.Load(), FormatBytes(p.bytesSeen.Load()),
+		p.filesHashed.Load(), FormatBytes(bytesHashed), FormatBytes(int64(rate)),
+		hitRate*100)
+	if hasETA && !final {
+		fmt.Fprintf(&buf, ", ETA %v", eta)
+	}
+	if final {
+		buf.WriteByte('\n')
+	} else if current != "" {
+		buf.WriteString(" ")
+		buf.WriteString(shortenPath(current, progressPathWidth))
+	}
+	_, _ = os.Stderr.WriteString(buf.String())
+}
+
+func shortenPath(path string, width int) string {
+	if len(path) <= width {
+		return path
+	}
+	return "..." + path[len(path)-width+3:]
+}
+
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value := float64(n)
+	suffixes := "KMGTPE"
+	i := -1
+	for value >= unit && i < len(suffixes)-1 {
+		value /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, suffixes[i])
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"cmp"
+	"path/filepath"
+	"slices"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/chronos-tachyon/go-dedupe/internal/pathutil"
+)
+
+type Root struct {
+	Path      string
+	Canonical string
+	Ref       bool
+	index     int
+}
+
+func CanonicalRoots(paths []string, refs []string) []Root {
+	roots := make([]Root, 0, len(paths)+len(refs))
+	for i, path := range append(paths[:len(paths):len(paths)], refs...) {
+		roots = append(roots, Root{
+			Path:      filepath.Clean(path),
+			Canonical: pathutil.Canonical(path),
+			Ref:       i >= len(paths),
+			index:     i,
+		})
+	}
+
+	slices.SortStableFunc(roots, func(a, b Root) int {
+		return cmp.Compare(len(a.Canonical), len(b.Canonical))
+	})
+
+	kept := make([]Root, 0, len(roots))
+	for _, root := range roots {
+		var outer *Root
+		for i := range kept {
+			if pathutil.IsWithin(root.Canonical, kept[i].Canonical) {
+				outer = &kept[i]
+				break
+			}
+		}
+		if outer != nil {
+			log.Logger.Info().
+				Str("path", root.Path).
+				Str("root", outer.Path).
+				Msg("skipping root that overlaps another root")
+			continue
+		}
+		kept = append(kept, root)
+	}
+
+	slices.SortFunc(kept, func(a, b Root) int {
+		return cmp.Compare(a.index, b.index)
+	})
+	return kept
+}
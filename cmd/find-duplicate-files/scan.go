@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/chronos-tachyon/go-dedupe/internal/ignore"
+	"github.com/chronos-tachyon/go-dedupe/internal/metadata"
+)
+
+const (
+	dedupeIgnoreName = ".dedupeignore"
+	gitIgnoreName    = ".gitignore"
+)
+
+func IgnoreFileNames() []string {
+	if flagGitignore {
+		return []string{gitIgnoreName, dedupeIgnoreName}
+	}
+	return []string{dedupeIgnoreName}
+}
+
+type Node struct {
+	Item   *Item
+	Ignore *ignore.Matcher
+	Ref    bool
+}
+
+type Scanner struct {
+	Stack      Stack
+	Candidates *Candidates
+	Visited    map[Inode]string
+	Roots      map[Inode]bool
+}
+
+func NewScanner() *Scanner {
+	return &Scanner{
+		Stack:      make(Stack, 0, 256),
+		Candidates: NewCandidates(),
+		Visited:    make(map[Inode]string, 1<<10),
+		Roots:      make(map[Inode]bool),
+	}
+}
+
+func (scanner *Scanner) Close() {
+	for !scanner.Stack.IsEmpty() {
+		scanner.Stack.Pop().Item.Close()
+	}
+}
+
+func (scanner *Scanner) AddRoot(rootPath string, ref bool) {
+	if it := Open(filepath.Clean(rootPath)); it != nil {
+		scanner.Roots[Inode{Dev: it.Dev, Ino: it.Ino}] = ref
+		scanner.Stack.Push(Node{Item: it, Ref: ref})
+	}
+}
+
+// MarkRoot records whether a root is a reference root without scanning it,
+// for roots that are nested inside another root and reached from there.
+func (scanner *Scanner) MarkRoot(rootPath string, ref bool) {
+	if it := Open(filepath.Clean(rootPath)); it != nil {
+		scanner.Roots[Inode{Dev: it.Dev, Ino: it.Ino}] = ref
+		it.Close()
+	}
+}
+
+func (scanner *Scanner) Run(ctx context.Context) {
+	for !scanner.Stack.IsEmpty() && ctx.Err() == nil {
+		scanner.Scan(scanner.Stack.Pop())
+		gCheckpoint.Save(false)
+	}
+}
+
+func (scanner *Scanner) Scan(node Node) {
+	it := node.Item
+	defer it.Close()
+	switch it.Mode.Type() {
+	case 0:
+		scanner.ScanFile(it, node.Ref)
+	case fs.ModeDir:
+		scanner.ScanDir(it, node.Ignore, node.Ref)
+	}
+}
+
+func (scanner *Scanner) ScanDir(it *Item, parentIgnore *ignore.Matcher, ref bool) {
+	if flagRules.Exclude(it) {
+		return
+	}
+
+	key := Inode{Dev: it.Dev, Ino: it.Ino}
+	if firstPath, found := scanner.Visited[key]; found {
+		log.Logger.Warn().
+			Str("path", it.Path).
+			Str("firstPath", firstPath).
+			Msg("directory already visited; skipping")
+		return
+	}
+	scanner.Visited[key] = it.Path
+	if rootRef, found := scanner.Roots[key]; found {
+		ref = rootRef
+	}
+	gProgress.SetCurrent(it.Path)
+
+	log.Logger.Debug().
+		Str("path", it.Path).
+		Msg("scan directory")
+
+	matcher, err := ignore.Load(parentIgnore, it.Path, IgnoreFileNames())
+	if err != nil {
+		log.Logger.Error().
+			Str("path", it.Path).
+			Err(err).
+			Msg("failed to read ignore file")
+	}
+
+	dents, err := it.File.ReadDir(-1)
+	if err != nil {
+		log.Logger.Error().
+			Str("path", it.Path).
+			Err(err).
+			Msg("failed to read directory")
+		return
+	}
+
+	var child *Item
+	for _, dent := range dents {
+		fileName := dent.Name()
+		if fileName == "." || fileName == ".." {
+			continue
+		}
+
+		filePath := filepath.Join(it.Path, fileName)
+		fileType := dent.Type()
+		switch fileType {
+		case 0:
+			// pass
+		case fs.ModeDir:
+			// pass
+		case fs.ModeSymlink:
+			if flagFollow == FollowNone {
+				continue
+			}
+			targetInfo, err := os.Stat(filePath)
+			if err != nil {
+				continue
+			}
+			switch targetType := targetInfo.Mode().Type(); {
+			case targetType == 0:
+				fileType = 0
+			case targetType == fs.ModeDir && flagFollow == FollowAll:
+				fileType = fs.ModeDir
+			default:
+				continue
+			}
+		default:
+			continue
+		}
+
+		if matcher.Ignored(filePath, fileType == fs.ModeDir) {
+			log.Logger.Debug().
+				Str("path", filePath).
+				Msg("ignored")
+			continue
+		}
+
+		child.Close()
+		child = Open(filePath)
+		if child == nil {
+			continue
+		}
+		fileType2 := child.Mode.Type()
+
+		if child.Dev != it.Dev {
+			if flagXdev {
+				continue
+			}
+			if fileType != fileType2 {
+				continue
+			}
+		}
+
+		if fileType != fileType2 {
+			log.Logger.Error().
+				Str("path", child.Path).
+				Stringer("readDirType", fileType).
+				Stringer("statType", fileType2).
+				Msg("file type mismatch")
+			continue
+		}
+
+		if fileType == fs.ModeDir {
+			scanner.Stack.Push(Node{Item: child, Ignore: matcher, Ref: ref})
+			child = nil
+			continue
+		}
+
+		scanner.ScanFile(child, ref)
+	}
+	child.Close()
+}
+
+func (scanner *Scanner) ScanFile(it *Item, ref bool) {
+	if it.Size < flagMinSize {
+		return
+	}
+	if flagRules.Exclude(it) {
+		return
+	}
+
+	log.Logger.Debug().
+		Str("path", it.Path).
+		Msg("scan file")
+
+	if flagRewrite {
+		stats := metadata.Rewrite(it.File, gNames)
+		if stats.Any() {
+			gRewriteStats.Add(stats)
+			gRewriteFiles++
+		}
+	}
+
+	entry := NewEntry(it)
+	entry.Ref = ref
+	if !scanner.Candidates.Add(entry) {
+		log.Logger.Debug().
+			Str("path", it.Path).
+			Msg("file already scanned; skipping")
+		return
+	}
+	gProgress.FileSeen(it.Size)
+}
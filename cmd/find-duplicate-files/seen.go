@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/hex"
+	"slices"
+	"sync"
+
+	"github.com/chronos-tachyon/go-dedupe/internal/metadata"
+	"github.com/chronos-tachyon/go-dedupe/internal/report"
+)
+
+type Group struct {
+	Meta    metadata.Metadata
+	Entries []Entry
+}
+
+func (group Group) Report() report.Group {
+	inodes := make(map[Inode]struct{}, len(group.Entries))
+	files := make([]report.File, len(group.Entries))
+	for i, entry := range group.Entries {
+		_, linked := inodes[entry.Inode()]
+		inodes[entry.Inode()] = struct{}{}
+		files[i] = report.File{
+			Path:   entry.Path,
+			Dev:    entry.Dev,
+			Ino:    entry.Ino,
+			Nlink:  entry.Nlink,
+			Time:   entry.Time,
+			Linked: linked,
+			Ref:    entry.Ref,
+		}
+	}
+
+	meta := group.Meta
+	return report.Group{
+		SHA256: hex.EncodeToString(meta.SHA256[:]),
+		SHA1:   hex.EncodeToString(meta.SHA1[:]),
+		MD5:    hex.EncodeToString(meta.MD5[:]),
+		Size:   meta.Size,
+		Wasted: meta.Size * int64(len(inodes)-1),
+		Files:  files,
+	}
+}
+
+func CompareGroups(a Group, b Group) int {
+	return CompareSHA256(a.Meta.SHA256, b.Meta.SHA256)
+}
+
+type Seen struct {
+	mu     sync.Mutex
+	byHash map[SHA256Sum]*Group
+}
+
+func NewSeen(capacity int) *Seen {
+	return &Seen{byHash: make(map[SHA256Sum]*Group, capacity)}
+}
+
+func (seen *Seen) Add(meta metadata.Metadata, entry Entry) {
+	seen.mu.Lock()
+	defer seen.mu.Unlock()
+
+	group := seen.byHash[meta.SHA256]
+	if group == nil {
+		group = &Group{Meta: meta, Entries: make([]Entry, 0, 1)}
+		seen.byHash[meta.SHA256] = group
+	}
+	group.Entries = append(group.Entries, entry)
+}
+
+func (seen *Seen) Groups() []Group {
+	seen.mu.Lock()
+	defer seen.mu.Unlock()
+
+	hashes := make(SHA256List, 0, len(seen.byHash))
+	for hash := range seen.byHash {
+		hashes = append(hashes, hash)
+	}
+	hashes.Sort()
+
+	groups := make([]Group, 0, len(hashes))
+	for _, hash := range hashes {
+		group := seen.byHash[hash]
+		if CountInodes(group.Entries) <= 1 {
+			continue
+		}
+		if !slices.ContainsFunc(group.Entries, func(entry Entry) bool { return !entry.Ref }) {
+			continue
+		}
+		slices.SortFunc(group.Entries, CompareEntries)
+		groups = append(groups, *group)
+	}
+	return groups
+}
+
+// CopiedPaths returns the paths of non-reference entries whose content also
+// appears among the reference entries.
+func (seen *Seen) CopiedPaths() map[string]struct{} {
+	seen.mu.Lock()
+	defer seen.mu.Unlock()
+
+	out := make(map[string]struct{})
+	for _, group := range seen.byHash {
+		if !slices.ContainsFunc(group.Entries, func(entry Entry) bool { return entry.Ref }) {
+			continue
+		}
+		for _, entry := range group.Entries {
+			if !entry.Ref {
+				out[entry.Path] = struct{}{}
+			}
+		}
+	}
+	return out
+}
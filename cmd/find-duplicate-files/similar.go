@@ -0,0 +1,174 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"io"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/chronos-tachyon/go-dedupe/internal/chunk"
+	"github.com/chronos-tachyon/go-dedupe/internal/report"
+	"github.com/chronos-tachyon/go-dedupe/internal/throttle"
+)
+
+// Chunks shared by more files than this (runs of zeroes, common headers) say
+// little about similarity and would make pairing quadratic.
+const maxFilesPerChunk = 256
+
+type ChunkInfo struct {
+	Hash chunk.Hash
+	Size int64
+}
+
+func ChunkFile(it *Item, params chunk.Params) ([]ChunkInfo, bool) {
+	throttle.Sequential(it.File)
+	c := chunk.NewChunker(throttle.NewReader(it.File), params)
+	seen := make(map[chunk.Hash]struct{})
+	var out []ChunkInfo
+	for {
+		ch, err := c.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Logger.Error().
+				Str("path", it.Path).
+				Err(err).
+				Msg("I/O error while reading file")
+			return nil, false
+		}
+		if _, found := seen[ch.Hash]; found {
+			continue
+		}
+		seen[ch.Hash] = struct{}{}
+		out = append(out, ChunkInfo{Hash: ch.Hash, Size: int64(ch.Size)})
+	}
+	return out, true
+}
+
+func FindSimilar(ctx context.Context, pool *Pool, entries []Entry, params chunk.Params, ratio float64) []report.Pair {
+	slices.SortFunc(entries, CompareEntries)
+	files := make([]Entry, 0, len(entries))
+	inodes := make(map[Inode]struct{}, len(entries))
+	for _, entry := range entries {
+		if _, found := inodes[entry.Inode()]; found || entry.Size <= 0 {
+			continue
+		}
+		inodes[entry.Inode()] = struct{}{}
+		files = append(files, entry)
+	}
+
+	var total int64
+	for _, entry := range files {
+		total += entry.Size
+	}
+	gProgress.StartHashing(total)
+
+	chunks := make([][]ChunkInfo, len(files))
+	var wg sync.WaitGroup
+	for i, entry := range files {
+		wg.Add(1)
+		i := i
+		SubmitEntry(ctx, pool, &wg, entry, func(it *Item) {
+			gProgress.SetCurrent(it.Path)
+			if list, ok := ChunkFile(it, params); ok {
+				chunks[i] = list
+			}
+			gProgress.FileHashed(it.Size, false)
+			gProgress.BytesDone(it.Size)
+		})
+	}
+	wg.Wait()
+
+	chunkSizes := make(map[chunk.Hash]int64)
+	postings := make(map[chunk.Hash][]int)
+	for i, list := range chunks {
+		for _, info := range list {
+			chunkSizes[info.Hash] = info.Size
+			postings[info.Hash] = append(postings[info.Hash], i)
+		}
+	}
+
+	compatible := func(a, b int64) bool {
+		return float64(min(a, b)) >= ratio*float64(max(a, b))
+	}
+
+	shared := make(map[[2]int]int64)
+	for hash, list := range postings {
+		if len(list) <= 1 || len(list) > maxFilesPerChunk {
+			continue
+		}
+		size := chunkSizes[hash]
+		for x, i := range list {
+			for _, j := range list[x+1:] {
+				if compatible(files[i].Size, files[j].Size) {
+					shared[[2]int{i, j}] += size
+				}
+			}
+		}
+	}
+
+	var pairs []report.Pair
+	for key, bytes := range shared {
+		a, b := files[key[0]], files[key[1]]
+		r := float64(bytes) / float64(max(a.Size, b.Size))
+		if r < ratio {
+			continue
+		}
+		pairs = append(pairs, report.Pair{
+			Files: [2]report.SimilarFile{
+				{Path: a.Path, Dev: a.Dev, Ino: a.Ino, Size: a.Size},
+				{Path: b.Path, Dev: b.Dev, Ino: b.Ino, Size: b.Size},
+			},
+			Shared: bytes,
+			Ratio:  r,
+		})
+	}
+	slices.SortFunc(pairs, func(a, b report.Pair) int {
+		if c := cmp.Compare(b.Ratio, a.Ratio); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.Files[0].Path, b.Files[0].Path); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Files[1].Path, b.Files[1].Path)
+	})
+	return pairs
+}
+
+func writeSimilar(ctx context.Context, cands *Candidates) bool {
+	params, err := chunk.NewParams(flagChunkSize)
+	if err != nil {
+		log.Logger.Fatal().
+			Int("chunkSize", flagChunkSize).
+			Err(err).
+			Msg("invalid -chunk-size")
+		panic(nil)
+	}
+
+	w, err := report.NewPairWriter(os.Stdout, flagFormat)
+	if err != nil {
+		log.Logger.Fatal().
+			Str("format", flagFormat.String()).
+			Err(err).
+			Msg("invalid -format for -similar")
+		panic(nil)
+	}
+
+	pool := NewPool(flagJobs)
+	pairs := FindSimilar(ctx, pool, cands.Entries(), params, flagSimilarRatio)
+	pool.Close()
+	gProgress.Stop()
+
+	for _, pair := range pairs {
+		if err := w.Write(pair); err != nil {
+			panic(err)
+		}
+	}
+
+	return finishOutput(ctx, w.Close, w.Abort)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"cmp"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/chronos-tachyon/go-dedupe/internal/report"
+)
+
+const blockSize = 512
+
+// Summarize totals the duplicate groups.  Within each group one inode is
+// kept; an inode only counts as reclaimable if every one of its links is in
+// the group and none of them is a reference file, and the kept inode is the
+// one whose removal would reclaim the least.
+func Summarize(groups []Group, top int) report.Summary {
+	var summary report.Summary
+	byDir := make(map[string]*report.SummaryEntry)
+	byExt := make(map[string]*report.SummaryEntry)
+	tally := func(m map[string]*report.SummaryEntry, name string, wasted int64, reclaim int64) {
+		row := m[name]
+		if row == nil {
+			row = &report.SummaryEntry{Name: name}
+			m[name] = row
+		}
+		row.Files++
+		row.WastedBytes += wasted
+		row.ReclaimableBytes += reclaim
+	}
+
+	for _, group := range groups {
+		summary.Groups++
+		summary.Files += len(group.Entries)
+
+		inodes := Bucket{Entries: group.Entries}.Inodes()
+		reclaim := make([]int64, len(inodes))
+		keep := 0
+		for i, links := range inodes {
+			if len(links) > 1 {
+				summary.HardlinkedFiles += len(links)
+			}
+			if !hasRef(links) && uint64(len(links)) >= links[0].Nlink {
+				reclaim[i] = links[0].Blocks * blockSize
+			}
+			if reclaim[i] < reclaim[keep] {
+				keep = i
+			}
+		}
+
+		size := group.Meta.Size
+		for i, links := range inodes {
+			if i == keep {
+				continue
+			}
+			summary.DuplicateFiles += len(links)
+			summary.WastedBytes += size
+			summary.ReclaimableBytes += reclaim[i]
+
+			path := links[0].Path
+			ext := strings.ToLower(filepath.Ext(path))
+			if ext == "" {
+				ext = "(none)"
+			}
+			tally(byDir, filepath.Dir(path), size, reclaim[i])
+			tally(byExt, ext, size, reclaim[i])
+		}
+	}
+
+	summary.TopDirectories = topEntries(byDir, top)
+	summary.TopExtensions = topEntries(byExt, top)
+	return summary
+}
+
+func topEntries(m map[string]*report.SummaryEntry, top int) []report.SummaryEntry {
+	out := make([]report.SummaryEntry, 0, len(m))
+	for _, row := range m {
+		out = append(out, *row)
+	}
+	slices.SortFunc(out, func(a, b report.SummaryEntry) int {
+		if c := cmp.Compare(b.ReclaimableBytes, a.ReclaimableBytes); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(b.WastedBytes, a.WastedBytes); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+	if top >= 0 && len(out) > top {
+		out = out[:top]
+	}
+	return out
+}
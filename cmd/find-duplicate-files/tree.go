@@ -0,0 +1,179 @@
+package main
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"slices"
+
+	"github.com/chronos-tachyon/go-dedupe/internal/report"
+)
+
+type DirNode struct {
+	Path  string
+	Inode Inode
+	Files []TreeFile
+	Dirs  []*DirNode
+	Hash  SHA256Sum
+	Size  int64
+	Count int
+	OK    bool
+}
+
+type TreeFile struct {
+	Name string
+	Hash SHA256Sum
+	Size int64
+	OK   bool
+}
+
+type DirGroup struct {
+	Hash SHA256Sum
+	Dirs []*DirNode
+}
+
+func (dg DirGroup) Report() report.Group {
+	files := make([]report.File, len(dg.Dirs))
+	for i, dir := range dg.Dirs {
+		files[i] = report.File{
+			Path: dir.Path,
+			Dev:  dir.Inode.Dev,
+			Ino:  dir.Inode.Ino,
+		}
+	}
+	size := dg.Dirs[0].Size
+	return report.Group{
+		SHA256: hex.EncodeToString(dg.Hash[:]),
+		Size:   size,
+		Wasted: size * int64(len(dg.Dirs)-1),
+		Dir:    true,
+		Files:  files,
+	}
+}
+
+// FindDuplicateTrees returns the topmost groups of identical directories,
+// plus the file groups not entirely contained within them.  A directory is
+// only eligible if every file beneath it belongs to some group of duplicates.
+// Empty directories take part in their parent's hash, but are never reported
+// on their own.
+func FindDuplicateTrees(visited map[Inode]string, entries []Entry, groups []Group) ([]DirGroup, []Group) {
+	byPath := make(map[string]*DirNode, len(visited))
+	for key, path := range visited {
+		byPath[path] = &DirNode{Path: path, Inode: key}
+	}
+
+	var roots []*DirNode
+	for _, dir := range byPath {
+		if parent := byPath[filepath.Dir(dir.Path)]; parent != nil && parent != dir {
+			parent.Dirs = append(parent.Dirs, dir)
+		} else {
+			roots = append(roots, dir)
+		}
+	}
+
+	hashByPath := make(map[string]SHA256Sum, len(entries))
+	for _, group := range groups {
+		for _, entry := range group.Entries {
+			hashByPath[entry.Path] = group.Meta.SHA256
+		}
+	}
+	for _, entry := range entries {
+		parent := byPath[filepath.Dir(entry.Path)]
+		if parent == nil {
+			continue
+		}
+		hash, ok := hashByPath[entry.Path]
+		parent.Files = append(parent.Files, TreeFile{
+			Name: filepath.Base(entry.Path),
+			Hash: hash,
+			Size: entry.Size,
+			OK:   ok,
+		})
+	}
+
+	byHash := make(map[SHA256Sum][]*DirNode, len(byPath))
+	for _, root := range roots {
+		hashTree(root, byHash)
+	}
+
+	dupDirs := make(map[string]struct{}, len(byPath))
+	var dirGroups []DirGroup
+	for hash, dirs := range byHash {
+		if len(dirs) <= 1 {
+			continue
+		}
+		for _, dir := range dirs {
+			dupDirs[dir.Path] = struct{}{}
+		}
+		dirGroups = append(dirGroups, DirGroup{Hash: hash, Dirs: dirs})
+	}
+
+	covered := func(path string) bool {
+		_, found := dupDirs[filepath.Dir(path)]
+		return found
+	}
+
+	topmost := dirGroups[:0]
+	for _, dg := range dirGroups {
+		if slices.ContainsFunc(dg.Dirs, func(dir *DirNode) bool { return !covered(dir.Path) }) {
+			slices.SortFunc(dg.Dirs, func(a, b *DirNode) int {
+				return cmp.Compare(a.Path, b.Path)
+			})
+			topmost = append(topmost, dg)
+		}
+	}
+	slices.SortFunc(topmost, func(a, b DirGroup) int {
+		return cmp.Compare(a.Dirs[0].Path, b.Dirs[0].Path)
+	})
+
+	remaining := groups[:0:0]
+	for _, group := range groups {
+		if slices.ContainsFunc(group.Entries, func(entry Entry) bool { return !covered(entry.Path) }) {
+			remaining = append(remaining, group)
+		}
+	}
+	return topmost, remaining
+}
+
+func hashTree(dir *DirNode, byHash map[SHA256Sum][]*DirNode) {
+	type child struct {
+		name string
+		kind byte
+		hash SHA256Sum
+	}
+
+	dir.OK = true
+	children := make([]child, 0, len(dir.Files)+len(dir.Dirs))
+	for _, file := range dir.Files {
+		dir.OK = dir.OK && file.OK
+		dir.Size += file.Size
+		dir.Count++
+		children = append(children, child{name: file.Name, kind: 'f', hash: file.Hash})
+	}
+	for _, sub := range dir.Dirs {
+		hashTree(sub, byHash)
+		dir.OK = dir.OK && sub.OK
+		dir.Size += sub.Size
+		dir.Count += sub.Count
+		children = append(children, child{name: filepath.Base(sub.Path), kind: 'd', hash: sub.Hash})
+	}
+	if !dir.OK {
+		return
+	}
+
+	slices.SortFunc(children, func(a, b child) int {
+		return cmp.Compare(a.name, b.name)
+	})
+	hasher := sha256.New()
+	for _, c := range children {
+		_, _ = hasher.Write([]byte{c.kind})
+		_, _ = hasher.Write([]byte(c.name))
+		_, _ = hasher.Write([]byte{0})
+		_, _ = hasher.Write(c.hash[:])
+	}
+	_ = hasher.Sum(dir.Hash[:0])
+	if dir.Count > 0 {
+		byHash[dir.Hash] = append(byHash[dir.Hash], dir)
+	}
+}
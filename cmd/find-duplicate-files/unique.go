@@ -0,0 +1,137 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/chronos-tachyon/go-dedupe/internal/report"
+)
+
+func hasRef(entries []Entry) bool {
+	return slices.ContainsFunc(entries, func(entry Entry) bool { return entry.Ref })
+}
+
+func hasNonRef(entries []Entry) bool {
+	return slices.ContainsFunc(entries, func(entry Entry) bool { return !entry.Ref })
+}
+
+func flattenLinks(class []Links) []Entry {
+	var out []Entry
+	for _, links := range class {
+		out = append(out, links...)
+	}
+	return out
+}
+
+// FindUnique returns the non-reference entries that have no content-identical
+// copy among the reference entries.  Files that cannot be read are reported as
+// unique, since no copy of them could be proven to exist.
+func FindUnique(ctx context.Context, pool *Pool, entries []Entry) []Entry {
+	bySize := make(map[int64][]Entry)
+	for _, entry := range entries {
+		bySize[entry.Size] = append(bySize[entry.Size], entry)
+	}
+	buckets := make([]Bucket, 0, len(bySize))
+	var total int64
+	for size, list := range bySize {
+		if hasRef(list) && hasNonRef(list) {
+			total += size * int64(CountInodes(list))
+		}
+		buckets = append(buckets, Bucket{Size: size, Entries: list})
+	}
+	slices.SortFunc(buckets, func(a, b Bucket) int {
+		return cmp.Compare(a.Size, b.Size)
+	})
+	gProgress.StartHashing(total)
+
+	var out []Entry
+	ForEachBucket(ctx, buckets, func(bucket Bucket) []Entry {
+		return UniqueInBucket(ctx, pool, bucket)
+	}, func(bucket Bucket, unique []Entry) {
+		out = append(out, unique...)
+	})
+	slices.SortFunc(out, CompareEntries)
+	return out
+}
+
+func UniqueInBucket(ctx context.Context, pool *Pool, bucket Bucket) []Entry {
+	if !hasNonRef(bucket.Entries) {
+		return nil
+	}
+	if !hasRef(bucket.Entries) {
+		return slices.DeleteFunc(slices.Clone(bucket.Entries), func(entry Entry) bool { return entry.Ref })
+	}
+
+	inodes := bucket.Inodes()
+	defer gProgress.BytesDone(bucket.Size * int64(len(inodes)))
+	classes := [][]Links{inodes}
+	if flagPartialSize > 0 && bucket.Size > 2*flagPartialSize {
+		classes = PartialClasses(ctx, pool, inodes)
+	}
+
+	seen := NewSeen(len(bucket.Entries))
+	var wg sync.WaitGroup
+	for _, class := range classes {
+		flat := flattenLinks(class)
+		if !hasRef(flat) || !hasNonRef(flat) {
+			continue
+		}
+		for _, links := range class {
+			wg.Add(1)
+			links := links
+			SubmitEntry(ctx, pool, &wg, links[0], func(it *Item) {
+				HashFile(seen, it, links)
+			})
+		}
+	}
+	wg.Wait()
+
+	copied := seen.CopiedPaths()
+	var out []Entry
+	for _, entry := range bucket.Entries {
+		if _, found := copied[entry.Path]; !found && !entry.Ref {
+			out = append(out, entry)
+		}
+	}
+	return out
+}
+
+func writeUnique(ctx context.Context, cands *Candidates) bool {
+	w, err := report.NewUniqueWriter(os.Stdout, flagFormat)
+	if err != nil {
+		log.Logger.Fatal().
+			Str("format", flagFormat.String()).
+			Err(err).
+			Msg("invalid -format for -unique-in")
+		panic(nil)
+	}
+
+	pool := NewPool(flagJobs)
+	unique := FindUnique(ctx, pool, cands.Entries())
+	pool.Close()
+	gProgress.Stop()
+
+	for _, entry := range unique {
+		err := w.Write(report.UniqueFile{
+			Path:  entry.Path,
+			Dev:   entry.Dev,
+			Ino:   entry.Ino,
+			Nlink: entry.Nlink,
+			Size:  entry.Size,
+			Time:  entry.Time,
+		})
+		if err != nil {
+			panic(err)
+		}
+	}
+	log.Logger.Info().
+		Int("files", len(unique)).
+		Msg("unique files found")
+
+	return finishOutput(ctx, w.Close, w.Abort)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/chronos-tachyon/go-dedupe/internal/throttle"
+)
+
+const verifyBlockSize = 1 << 15
+
+func VerifyGroups(groups []Group) []Group {
+	seen := NewSeen(len(groups))
+	for _, group := range groups {
+		for _, class := range VerifyGroup(group) {
+			for _, entry := range class.Entries {
+				seen.Add(class.Meta, entry)
+			}
+		}
+	}
+	return seen.Groups()
+}
+
+func VerifyGroup(group Group) []Group {
+	items := make([]*Item, 0, len(group.Entries))
+	entries := make([]Entry, 0, len(group.Entries))
+	defer func() {
+		for _, it := range items {
+			it.Close()
+		}
+	}()
+
+	for _, entry := range group.Entries {
+		it := Open(entry.Path)
+		if it == nil {
+			continue
+		}
+		if _, err := it.File.Seek(0, io.SeekStart); err != nil {
+			log.Logger.Error().
+				Str("path", it.Path).
+				Err(err).
+				Msg("failed to rewind file to start")
+			it.Close()
+			continue
+		}
+		items = append(items, it)
+		entries = append(entries, entry)
+	}
+
+	cachedSHA256 := hex.EncodeToString(group.Meta.SHA256[:])
+	if len(items) < len(group.Entries) {
+		log.Logger.Warn().
+			Str("sha256", cachedSHA256).
+			Int("files", len(group.Entries)).
+			Int("unopened", len(group.Entries)-len(items)).
+			Msg("leaving files that could not be opened out of the verified group")
+	}
+
+	classes := compareContents(items)
+	if len(classes) == 0 {
+		return nil
+	}
+	if len(classes) == 1 && len(classes[0]) == len(group.Entries) {
+		return []Group{group}
+	}
+	if len(classes) == 1 {
+		classEntries := make([]Entry, 0, len(classes[0]))
+		for _, index := range classes[0] {
+			classEntries = append(classEntries, entries[index])
+		}
+		return []Group{{Meta: group.Meta, Entries: classEntries}}
+	}
+
+	log.Logger.Warn().
+		Str("sha256", cachedSHA256).
+		Int("files", len(items)).
+		Int("classes", len(classes)).
+		Msg("files with the same hash have different contents")
+
+	out := make([]Group, 0, len(classes))
+	for _, class := range classes {
+		trusted := false
+		for _, index := range class {
+			if !entries[index].Cached {
+				trusted = true
+				break
+			}
+		}
+
+		meta := group.Meta
+		if !trusted {
+			first := items[class[0]]
+			if !meta.Compute(first.File, first.Size, first.Time) {
+				continue
+			}
+		}
+
+		wrong := meta.SHA256 != group.Meta.SHA256
+		classEntries := make([]Entry, 0, len(class))
+		for _, index := range class {
+			it, entry := items[index], entries[index]
+			if wrong {
+				log.Logger.Warn().
+					Str("path", it.Path).
+					Str("cachedSHA256", cachedSHA256).
+					Msg("memoized hash does not match file contents")
+				gStore.Save(it, meta)
+			}
+			entry.Cached = false
+			classEntries = append(classEntries, entry)
+		}
+		out = append(out, Group{Meta: meta, Entries: classEntries})
+	}
+	return out
+}
+
+func compareContents(items []*Item) [][]int {
+	bufs := make([][]byte, len(items))
+	for i := range bufs {
+		bufs[i] = make([]byte, verifyBlockSize)
+		throttle.Sequential(items[i].File)
+	}
+
+	active := make([]int, len(items))
+	for i := range active {
+		active[i] = i
+	}
+
+	var done [][]int
+	pending := [][]int{active}
+	for len(pending) > 0 {
+		var next [][]int
+		for _, class := range pending {
+			class = readBlocks(items, bufs, class)
+			for _, sub := range splitClass(bufs, class) {
+				switch {
+				case len(sub) <= 1:
+					done = append(done, sub)
+				case len(bufs[sub[0]]) < verifyBlockSize:
+					done = append(done, sub)
+				default:
+					next = append(next, sub)
+				}
+			}
+		}
+		pending = next
+	}
+	return done
+}
+
+func readBlocks(items []*Item, bufs [][]byte, class []int) []int {
+	ok := class[:0:0]
+	for _, index := range class {
+		it := items[index]
+		n, err := io.ReadFull(throttle.NewReader(it.File), bufs[index][:verifyBlockSize])
+		bufs[index] = bufs[index][:n]
+		switch err {
+		case nil:
+			// pass
+		case io.EOF, io.ErrUnexpectedEOF:
+			// pass
+		default:
+			log.Logger.Error().
+				Str("path", it.Path).
+				Err(err).
+				Msg("I/O error while reading file")
+			continue
+		}
+		ok = append(ok, index)
+	}
+	return ok
+}
+
+func splitClass(bufs [][]byte, class []int) [][]int {
+	var out [][]int
+	for _, index := range class {
+		found := false
+		for j, sub := range out {
+			if bytes.Equal(bufs[sub[0]], bufs[index]) {
+				out[j] = append(sub, index)
+				found = true
+				break
+			}
+		}
+		if !found {
+			out = append(out, []int{index})
+		}
+	}
+	return out
+}
@@ -4,13 +4,11 @@ go 1.21.1
 
 require (
 	github.com/chronos-tachyon/go-autolog v0.1.0
+	github.com/mattn/go-isatty v0.0.20
 	github.com/pkg/xattr v0.4.9
 	github.com/rs/zerolog v1.31.0
+	golang.org/x/sys v0.15.0
 	golang.org/x/text v0.14.0
 )
 
-require (
-	github.com/mattn/go-colorable v0.1.13 // indirect
-	github.com/mattn/go-isatty v0.0.20 // indirect
-	golang.org/x/sys v0.15.0 // indirect
-)
+require github.com/mattn/go-colorable v0.1.13 // indirect
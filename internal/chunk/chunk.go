@@ -0,0 +1,137 @@
+package chunk
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+type Hash [sha256.Size]byte
+
+// MaxAvg bounds the average chunk size.  Each Chunker buffers sixteen times
+// the average, so this keeps a worker's buffer at 16 MiB.
+const MaxAvg = 1 << 20
+
+type Params struct {
+	Min int
+	Avg int
+	Max int
+}
+
+// NewParams returns chunking parameters for the given average chunk size,
+// which is rounded down to a power of two.
+func NewParams(avg int) (Params, error) {
+	if avg < 64 {
+		return Params{}, fmt.Errorf("average chunk size %d is too small; must be at least 64", avg)
+	}
+	if avg > MaxAvg {
+		return Params{}, fmt.Errorf("average chunk size %d is too large; must be at most %d", avg, MaxAvg)
+	}
+	avg = 1 << (bits.Len(uint(avg)) - 1)
+	return Params{Min: avg / 4, Avg: avg, Max: avg * 8}, nil
+}
+
+func (p Params) mask() uint64 {
+	n := bits.Len(uint(p.Avg)) - 1
+	return ((uint64(1) << n) - 1) << (64 - n)
+}
+
+type Chunk struct {
+	Offset int64
+	Size   int
+	Hash   Hash
+}
+
+// Chunker splits a stream into content-defined chunks using a gear rolling
+// hash, so that an insertion only changes the chunks around it.
+type Chunker struct {
+	r      io.Reader
+	params Params
+	mask   uint64
+	buf    []byte
+	start  int
+	end    int
+	offset int64
+	eof    bool
+}
+
+func NewChunker(r io.Reader, params Params) *Chunker {
+	return &Chunker{
+		r:      r,
+		params: params,
+		mask:   params.mask(),
+		buf:    make([]byte, 2*params.Max),
+	}
+}
+
+func (c *Chunker) fill() error {
+	if c.start > 0 {
+		c.end = copy(c.buf, c.buf[c.start:c.end])
+		c.start = 0
+	}
+	for !c.eof && c.end < len(c.buf) {
+		n, err := c.r.Read(c.buf[c.end:])
+		c.end += n
+		if err == io.EOF {
+			c.eof = true
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Chunker) Next() (Chunk, error) {
+	if c.end-c.start < c.params.Max && !c.eof {
+		if err := c.fill(); err != nil {
+			return Chunk{}, err
+		}
+	}
+
+	data := c.buf[c.start:c.end]
+	if len(data) <= 0 {
+		return Chunk{}, io.EOF
+	}
+
+	size := c.cut(data)
+	chunk := Chunk{
+		Offset: c.offset,
+		Size:   size,
+		Hash:   sha256.Sum256(data[:size]),
+	}
+	c.start += size
+	c.offset += int64(size)
+	return chunk, nil
+}
+
+func (c *Chunker) cut(data []byte) int {
+	if len(data) <= c.params.Min {
+		return len(data)
+	}
+	limit := min(len(data), c.params.Max)
+	var h uint64
+	for i := c.params.Min; i < limit; i++ {
+		h = (h << 1) + gear[data[i]]
+		if h&c.mask == 0 {
+			return i + 1
+		}
+	}
+	return limit
+}
+
+var gear = func() [256]uint64 {
+	var table [256]uint64
+	state := uint64(0x9e3779b97f4a7c15)
+	for i := range table {
+		// splitmix64
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
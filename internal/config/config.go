@@ -0,0 +1,294 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/chronos-tachyon/go-dedupe/internal/metadata"
+)
+
+type Rule struct {
+	Pattern string
+	Exclude bool
+}
+
+type NamesConfig struct {
+	Stamp   *string
+	Size    *string
+	Time    *string
+	MD5     *string
+	SHA1    *string
+	SHA256  *string
+	Partial *string
+}
+
+func (nc NamesConfig) Apply(names metadata.Names) metadata.Names {
+	apply := func(out *string, in *string) {
+		if in != nil {
+			*out = *in
+		}
+	}
+	apply(&names.Stamp, nc.Stamp)
+	apply(&names.Size, nc.Size)
+	apply(&names.Time, nc.Time)
+	apply(&names.MD5, nc.MD5)
+	apply(&names.SHA1, nc.SHA1)
+	apply(&names.SHA256, nc.SHA256)
+	apply(&names.Partial, nc.Partial)
+	return names
+}
+
+type ScanConfig struct {
+	Rules       []Rule
+	Refs        []string
+	MinSize     *int64
+	Jobs        *int64
+	Xdev        *bool
+	Follow      *string
+	Gitignore   *bool
+	Store       *string
+	Cache       *string
+	MaxReadRate *string
+	DropCache   *bool
+	NoAtime     *bool
+	IdleIO      *bool
+}
+
+type OutputConfig struct {
+	Format *string
+}
+
+type CleanConfig struct {
+	Prefer []string
+	Refs   []string
+	Rel    *bool
+	Format *string
+}
+
+type Config struct {
+	Namespace *string
+	Names     NamesConfig
+	Scan      ScanConfig
+	Output    OutputConfig
+	Clean     CleanConfig
+}
+
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "go-dedupe", "config.toml")
+}
+
+func Load(path string, mustExist bool) (*Config, error) {
+	if path == "" {
+		path = DefaultPath()
+	}
+	if path == "" {
+		return &Config{}, nil
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) && !mustExist {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	doc, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	cfg, err := FromDocument(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func FromDocument(doc Document) (*Config, error) {
+	var cfg Config
+	var d decoder
+
+	root := d.table(doc, "")
+	d.getString(root, "", "namespace", &cfg.Namespace)
+
+	names := d.table(doc, "names")
+	d.getString(names, "names", "stamp", &cfg.Names.Stamp)
+	d.getString(names, "names", "size", &cfg.Names.Size)
+	d.getString(names, "names", "mtime", &cfg.Names.Time)
+	d.getString(names, "names", "md5", &cfg.Names.MD5)
+	d.getString(names, "names", "sha1", &cfg.Names.SHA1)
+	d.getString(names, "names", "sha256", &cfg.Names.SHA256)
+	d.getString(names, "names", "partial", &cfg.Names.Partial)
+
+	scan := d.table(doc, "scan")
+	for _, raw := range d.getStrings(scan, "scan", "rules") {
+		rule, err := parseRule(raw)
+		if err != nil {
+			d.fail(fmt.Errorf("[scan] rules: %w", err))
+			continue
+		}
+		cfg.Scan.Rules = append(cfg.Scan.Rules, rule)
+	}
+	cfg.Scan.Refs = d.getStrings(scan, "scan", "refs")
+	d.getInt(scan, "scan", "min-size", &cfg.Scan.MinSize)
+	d.getInt(scan, "scan", "jobs", &cfg.Scan.Jobs)
+	d.getBool(scan, "scan", "xdev", &cfg.Scan.Xdev)
+	d.getString(scan, "scan", "follow", &cfg.Scan.Follow)
+	d.getBool(scan, "scan", "gitignore", &cfg.Scan.Gitignore)
+	d.getString(scan, "scan", "store", &cfg.Scan.Store)
+	d.getString(scan, "scan", "cache", &cfg.Scan.Cache)
+	d.getString(scan, "scan", "max-read-rate", &cfg.Scan.MaxReadRate)
+	d.getBool(scan, "scan", "drop-cache", &cfg.Scan.DropCache)
+	d.getBool(scan, "scan", "noatime", &cfg.Scan.NoAtime)
+	d.getBool(scan, "scan", "idle-io", &cfg.Scan.IdleIO)
+
+	output := d.table(doc, "output")
+	d.getString(output, "output", "format", &cfg.Output.Format)
+
+	clean := d.table(doc, "clean")
+	cfg.Clean.Prefer = d.getStrings(clean, "clean", "prefer")
+	cfg.Clean.Refs = d.getStrings(clean, "clean", "refs")
+	d.getBool(clean, "clean", "rel", &cfg.Clean.Rel)
+	d.getString(clean, "clean", "format", &cfg.Clean.Format)
+
+	for name, table := range doc {
+		if !d.known(name) {
+			d.fail(fmt.Errorf("unknown table [%s]", name))
+			continue
+		}
+		for key := range table {
+			d.fail(fmt.Errorf("unknown key %q in %s", key, tableName(name)))
+		}
+	}
+
+	if err := d.err(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func parseRule(raw string) (Rule, error) {
+	switch {
+	case strings.HasPrefix(raw, "+"):
+		return Rule{Pattern: strings.TrimSpace(raw[1:]), Exclude: false}, nil
+	case strings.HasPrefix(raw, "-"):
+		return Rule{Pattern: strings.TrimSpace(raw[1:]), Exclude: true}, nil
+	default:
+		return Rule{}, fmt.Errorf("rule %q must start with '+' (include) or '-' (exclude)", raw)
+	}
+}
+
+func tableName(name string) string {
+	if name == "" {
+		return "root table"
+	}
+	return "[" + name + "]"
+}
+
+type decoder struct {
+	errs  []string
+	names []string
+}
+
+func (d *decoder) fail(err error) {
+	d.errs = append(d.errs, err.Error())
+}
+
+func (d *decoder) err() error {
+	if len(d.errs) <= 0 {
+		return nil
+	}
+	sort.Strings(d.errs)
+	return errors.New(strings.Join(d.errs, "; "))
+}
+
+func (d *decoder) known(name string) bool {
+	for _, known := range d.names {
+		if known == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *decoder) table(doc Document, name string) Table {
+	d.names = append(d.names, name)
+	return doc[name]
+}
+
+func (d *decoder) take(table Table, key string) (any, bool) {
+	value, found := table[key]
+	if found {
+		delete(table, key)
+	}
+	return value, found
+}
+
+func (d *decoder) getString(table Table, name string, key string, out **string) {
+	value, found := d.take(table, key)
+	if !found {
+		return
+	}
+	if str, ok := value.(string); ok {
+		*out = &str
+		return
+	}
+	d.fail(fmt.Errorf("%s %q: expected string", tableName(name), key))
+}
+
+func (d *decoder) getInt(table Table, name string, key string, out **int64) {
+	value, found := d.take(table, key)
+	if !found {
+		return
+	}
+	if i64, ok := value.(int64); ok {
+		*out = &i64
+		return
+	}
+	d.fail(fmt.Errorf("%s %q: expected integer", tableName(name), key))
+}
+
+func (d *decoder) getBool(table Table, name string, key string, out **bool) {
+	value, found := d.take(table, key)
+	if !found {
+		return
+	}
+	if b, ok := value.(bool); ok {
+		*out = &b
+		return
+	}
+	d.fail(fmt.Errorf("%s %q: expected boolean", tableName(name), key))
+}
+
+func (d *decoder) getStrings(table Table, name string, key string) []string {
+	value, found := d.take(table, key)
+	if !found {
+		return nil
+	}
+	list, ok := value.([]any)
+	if !ok {
+		d.fail(fmt.Errorf("%s %q: expected array of strings", tableName(name), key))
+		return nil
+	}
+	out := make([]string, 0, len(list))
+	for _, elem := range list {
+		str, ok := elem.(string)
+		if !ok {
+			d.fail(fmt.Errorf("%s %q: expected array of strings", tableName(name), key))
+			return nil
+		}
+		out = append(out, str)
+	}
+	return out
+}
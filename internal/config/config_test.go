@@ -0,0 +1,109 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	input := `namespace = "user.dedupe."
+
+[names]
+mtime = "user.mtime"
+
+[scan]
+rules = ["- *.tmp", "+ keep.tmp"]
+refs = ["/ref"]
+min-size = 0x100
+xdev = true
+follow = "roots"
+
+[output]
+format = "rich"
+
+[clean]
+prefer = ["/a", "/b"]
+rel = false
+`
+	if err := os.WriteFile(path, []byte(input), 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path, true)
+	if err != nil {
+		t.Fatalf("Load: unexpected error: %v", err)
+	}
+
+	str := func(s string) *string { return &s }
+	i64 := func(i int64) *int64 { return &i }
+	boolean := func(b bool) *bool { return &b }
+	expect := &Config{
+		Namespace: str("user.dedupe."),
+		Names:     NamesConfig{Time: str("user.mtime")},
+		Scan: ScanConfig{
+			Rules:   []Rule{{Pattern: "*.tmp", Exclude: true}, {Pattern: "keep.tmp"}},
+			Refs:    []string{"/ref"},
+			MinSize: i64(256),
+			Xdev:    boolean(true),
+			Follow:  str("roots"),
+		},
+		Output: OutputConfig{Format: str("rich")},
+		Clean: CleanConfig{
+			Prefer: []string{"/a", "/b"},
+			Rel:    boolean(false),
+		},
+	}
+	if !reflect.DeepEqual(cfg, expect) {
+		t.Errorf("Load: wrong result\n\texpect: %+v\n\tactual: %+v", expect, cfg)
+	}
+}
+
+func TestLoadMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.toml")
+	if cfg, err := Load(path, false); err != nil || !reflect.DeepEqual(cfg, &Config{}) {
+		t.Errorf("Load: expected an empty config, got %+v, %v", cfg, err)
+	}
+	if _, err := Load(path, true); err == nil {
+		t.Error("Load: expected an error for a required file that does not exist")
+	}
+}
+
+func TestFromDocumentErrors(t *testing.T) {
+	type testCase struct {
+		Name   string
+		Input  string
+		Expect string
+	}
+
+	testData := [...]testCase{
+		{Name: "unknown-root-key", Input: "nmaespace = \"x\"\n", Expect: `unknown key "nmaespace" in root table`},
+		{Name: "unknown-table", Input: "[sacn]\nxdev = true\n", Expect: "unknown table [sacn]"},
+		{Name: "unknown-key", Input: "[scan]\nmin_size = 1\n", Expect: `unknown key "min_size" in [scan]`},
+		{Name: "wrong-type-string", Input: "[output]\nformat = 1\n", Expect: `[output] "format": expected string`},
+		{Name: "wrong-type-integer", Input: "[scan]\nmin-size = \"1\"\n", Expect: `[scan] "min-size": expected integer`},
+		{Name: "wrong-type-boolean", Input: "[clean]\nrel = 1\n", Expect: `[clean] "rel": expected boolean`},
+		{Name: "wrong-type-array", Input: "[scan]\nrefs = \"/ref\"\n", Expect: `[scan] "refs": expected array of strings`},
+		{Name: "wrong-type-element", Input: "[scan]\nrefs = [1]\n", Expect: `[scan] "refs": expected array of strings`},
+		{Name: "bad-rule", Input: "[scan]\nrules = [\"*.tmp\"]\n", Expect: "must start with '+' (include) or '-' (exclude)"},
+	}
+
+	for _, row := range testData {
+		t.Run(row.Name, func(t *testing.T) {
+			doc, err := Parse(strings.NewReader(row.Input))
+			if err != nil {
+				t.Fatalf("Parse: unexpected error: %v", err)
+			}
+			cfg, err := FromDocument(doc)
+			if err == nil {
+				t.Fatalf("FromDocument: expected error containing %q, got %+v", row.Expect, cfg)
+			}
+			if !strings.Contains(err.Error(), row.Expect) {
+				t.Errorf("FromDocument: expected error containing %q, got %q", row.Expect, err.Error())
+			}
+		})
+	}
+}
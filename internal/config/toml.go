@@ -0,0 +1,287 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type Table map[string]any
+
+type Document map[string]Table
+
+type parser struct {
+	doc     Document
+	table   string
+	lineNum int
+	lines   []string
+}
+
+// Parse reads a document in the subset of TOML used by go-dedupe:
+// [table] headers, bare or quoted keys, and values that are strings,
+// integers, booleans, or (possibly multi-line) arrays of those.
+func Parse(r io.Reader) (Document, error) {
+	var lines []string
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	p := &parser{doc: Document{"": Table{}}, lines: lines}
+	for p.lineNum < len(p.lines) {
+		line := p.lines[p.lineNum]
+		p.lineNum++
+		if err := p.parseLine(line); err != nil {
+			return nil, fmt.Errorf("line %d: %w", p.lineNum, err)
+		}
+	}
+	return p.doc, nil
+}
+
+func (p *parser) parseLine(line string) error {
+	rest := skipSpace(line)
+	if rest == "" || rest[0] == '#' {
+		return nil
+	}
+
+	if rest[0] == '[' {
+		end := strings.IndexByte(rest, ']')
+		if end < 0 {
+			return errors.New("unterminated table header")
+		}
+		name := strings.TrimSpace(rest[1:end])
+		if name == "" || strings.HasPrefix(name, "[") {
+			return fmt.Errorf("unsupported table header %q", rest[:end+1])
+		}
+		if err := expectEnd(rest[end+1:]); err != nil {
+			return err
+		}
+		if _, found := p.doc[name]; found {
+			return fmt.Errorf("duplicate table [%s]", name)
+		}
+		p.doc[name] = Table{}
+		p.table = name
+		return nil
+	}
+
+	key, rest, err := parseKey(rest)
+	if err != nil {
+		return err
+	}
+	rest = skipSpace(rest)
+	if rest == "" || rest[0] != '=' {
+		return fmt.Errorf("expected '=' after key %q", key)
+	}
+	value, rest, err := p.parseValue(skipSpace(rest[1:]))
+	if err != nil {
+		return fmt.Errorf("key %q: %w", key, err)
+	}
+	if err := expectEnd(rest); err != nil {
+		return err
+	}
+
+	table := p.doc[p.table]
+	if _, found := table[key]; found {
+		return fmt.Errorf("duplicate key %q", key)
+	}
+	table[key] = value
+	return nil
+}
+
+func (p *parser) parseValue(input string) (any, string, error) {
+	switch {
+	case input == "":
+		return nil, "", errors.New("missing value")
+	case input[0] == '"':
+		return parseBasicString(input)
+	case input[0] == '\'':
+		end := strings.IndexByte(input[1:], '\'')
+		if end < 0 {
+			return nil, "", errors.New("unterminated string")
+		}
+		return input[1 : end+1], input[end+2:], nil
+	case input[0] == '[':
+		return p.parseArray(input[1:])
+	case strings.HasPrefix(input, "true"):
+		return true, input[4:], nil
+	case strings.HasPrefix(input, "false"):
+		return false, input[5:], nil
+	default:
+		end := strings.IndexAny(input, " \t,]#")
+		if end < 0 {
+			end = len(input)
+		}
+		i64, err := parseInteger(input[:end])
+		if err != nil {
+			return nil, "", err
+		}
+		return i64, input[end:], nil
+	}
+}
+
+// parseInteger accepts TOML integers: decimal with an optional sign and no
+// leading zeros, or unsigned 0x, 0o, and 0b forms, with single underscores
+// allowed between digits.
+func parseInteger(raw string) (int64, error) {
+	sign, digits := "", raw
+	if digits != "" && (digits[0] == '+' || digits[0] == '-') {
+		sign, digits = digits[:1], digits[1:]
+	}
+
+	base := 10
+	if len(digits) >= 2 && digits[0] == '0' {
+		switch digits[1] {
+		case 'x':
+			base = 16
+		case 'o':
+			base = 8
+		case 'b':
+			base = 2
+		default:
+			return 0, fmt.Errorf("invalid value %q: leading zeros are not allowed", raw)
+		}
+		if sign != "" {
+			return 0, fmt.Errorf("invalid value %q: sign is not allowed with a base prefix", raw)
+		}
+		digits = digits[2:]
+	}
+
+	if strings.HasPrefix(digits, "_") || strings.HasSuffix(digits, "_") || strings.Contains(digits, "__") {
+		return 0, fmt.Errorf("invalid value %q: underscores must be between digits", raw)
+	}
+	i64, err := strconv.ParseInt(sign+strings.ReplaceAll(digits, "_", ""), base, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", raw)
+	}
+	return i64, nil
+}
+
+func (p *parser) parseArray(input string) (any, string, error) {
+	list := make([]any, 0, 4)
+	for {
+		input = skipSpace(input)
+		for input == "" || input[0] == '#' {
+			if p.lineNum >= len(p.lines) {
+				return nil, "", errors.New("unterminated array")
+			}
+			input = skipSpace(p.lines[p.lineNum])
+			p.lineNum++
+		}
+		if input[0] == ']' {
+			return list, input[1:], nil
+		}
+
+		value, rest, err := p.parseValue(input)
+		if err != nil {
+			return nil, "", err
+		}
+		list = append(list, value)
+
+		rest = skipSpace(rest)
+		if rest != "" && rest[0] == ',' {
+			rest = rest[1:]
+		} else if rest != "" && rest[0] != ']' && rest[0] != '#' {
+			return nil, "", fmt.Errorf("expected ',' or ']' in array; got %q", rest)
+		}
+		input = rest
+	}
+}
+
+func parseKey(input string) (string, string, error) {
+	if input[0] == '"' {
+		value, rest, err := parseBasicString(input)
+		if err != nil {
+			return "", "", err
+		}
+		return value.(string), rest, nil
+	}
+	end := 0
+	for end < len(input) && isBareKeyChar(input[end]) {
+		end++
+	}
+	if end == 0 {
+		return "", "", fmt.Errorf("invalid key at %q", input)
+	}
+	return input[:end], input[end:], nil
+}
+
+func isBareKeyChar(ch byte) bool {
+	switch {
+	case ch >= 'a' && ch <= 'z':
+		return true
+	case ch >= 'A' && ch <= 'Z':
+		return true
+	case ch >= '0' && ch <= '9':
+		return true
+	case ch == '_' || ch == '-':
+		return true
+	default:
+		return false
+	}
+}
+
+func parseBasicString(input string) (any, string, error) {
+	var buf strings.Builder
+	i := 1
+	for i < len(input) {
+		ch := input[i]
+		switch {
+		case ch == '"':
+			return buf.String(), input[i+1:], nil
+
+		case ch == '\\' && i+1 < len(input):
+			i++
+			switch esc := input[i]; esc {
+			case '"', '\\':
+				buf.WriteByte(esc)
+			case 'n':
+				buf.WriteByte('\n')
+			case 't':
+				buf.WriteByte('\t')
+			case 'r':
+				buf.WriteByte('\r')
+			case 'u', 'U':
+				size := 4
+				if esc == 'U' {
+					size = 8
+				}
+				if i+size >= len(input) {
+					return nil, "", errors.New("truncated unicode escape")
+				}
+				u64, err := strconv.ParseUint(input[i+1:i+1+size], 16, 32)
+				if err != nil || !utf8.ValidRune(rune(u64)) {
+					return nil, "", fmt.Errorf("invalid unicode escape %q", input[i-1:i+1+size])
+				}
+				buf.WriteRune(rune(u64))
+				i += size
+			default:
+				return nil, "", fmt.Errorf("invalid escape \\%c", esc)
+			}
+			i++
+
+		default:
+			buf.WriteByte(ch)
+			i++
+		}
+	}
+	return nil, "", errors.New("unterminated string")
+}
+
+func skipSpace(input string) string {
+	return strings.TrimLeft(input, " \t")
+}
+
+func expectEnd(input string) error {
+	input = skipSpace(input)
+	if input != "" && input[0] != '#' {
+		return fmt.Errorf("unexpected trailing characters %q", input)
+	}
+	return nil
+}
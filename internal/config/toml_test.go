@@ -0,0 +1,160 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	type testCase struct {
+		Name   string
+		Input  string
+		Expect Document
+	}
+
+	testData := [...]testCase{
+		{
+			Name:   "empty",
+			Input:  "",
+			Expect: Document{"": Table{}},
+		},
+		{
+			Name:   "comments-and-blank-lines",
+			Input:  "# comment\n\n   # indented comment\n",
+			Expect: Document{"": Table{}},
+		},
+		{
+			Name:  "root-keys",
+			Input: "a = 1\nb = true\nc = false\nd = \"x\"\n",
+			Expect: Document{"": Table{
+				"a": int64(1),
+				"b": true,
+				"c": false,
+				"d": "x",
+			}},
+		},
+		{
+			Name:  "tables",
+			Input: "top = 1\n[scan]\nxdev = true # trailing comment\n[ clean ]\nrel = false\n",
+			Expect: Document{
+				"":      Table{"top": int64(1)},
+				"scan":  Table{"xdev": true},
+				"clean": Table{"rel": false},
+			},
+		},
+		{
+			Name:  "quoted-key",
+			Input: "\"odd key\" = 1\n",
+			Expect: Document{"": Table{
+				"odd key": int64(1),
+			}},
+		},
+		{
+			Name:  "integers",
+			Input: "a = 0\nb = -17\nc = +42\nd = 1_000_000\ne = 0x1F\nf = 0o17\ng = 0b101\nh = 0xdead_beef\n",
+			Expect: Document{"": Table{
+				"a": int64(0),
+				"b": int64(-17),
+				"c": int64(42),
+				"d": int64(1000000),
+				"e": int64(31),
+				"f": int64(15),
+				"g": int64(5),
+				"h": int64(0xdeadbeef),
+			}},
+		},
+		{
+			Name:  "strings",
+			Input: `a = "tab\there"` + "\n" + `b = 'C:\no\escapes'` + "\n" + `c = "\u00e9\U0001F600 \"q\" \\"` + "\n",
+			Expect: Document{"": Table{
+				"a": "tab\there",
+				"b": `C:\no\escapes`,
+				"c": "\u00e9\U0001F600 \"q\" \\",
+			}},
+		},
+		{
+			Name:  "arrays",
+			Input: "a = []\nb = [1, 2, 3]\nc = [\"x\", 'y',]\n",
+			Expect: Document{"": Table{
+				"a": []any{},
+				"b": []any{int64(1), int64(2), int64(3)},
+				"c": []any{"x", "y"},
+			}},
+		},
+		{
+			Name:  "multi-line-array",
+			Input: "[scan]\nrefs = [\n  \"/a\", # first\n\n  \"/b\",\n]\nxdev = true\n",
+			Expect: Document{
+				"":     Table{},
+				"scan": Table{"refs": []any{"/a", "/b"}, "xdev": true},
+			},
+		},
+	}
+
+	for _, row := range testData {
+		t.Run(row.Name, func(t *testing.T) {
+			doc, err := Parse(strings.NewReader(row.Input))
+			if err != nil {
+				t.Fatalf("Parse: unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(doc, row.Expect) {
+				t.Errorf("Parse: wrong result\n\texpect: %#v\n\tactual: %#v", row.Expect, doc)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	type testCase struct {
+		Name   string
+		Input  string
+		Expect string
+	}
+
+	testData := [...]testCase{
+		{Name: "leading-zero", Input: "min-size = 010\n", Expect: "leading zeros"},
+		{Name: "signed-leading-zero", Input: "a = -007\n", Expect: "leading zeros"},
+		{Name: "signed-hex", Input: "a = -0x10\n", Expect: "sign is not allowed"},
+		{Name: "leading-underscore", Input: "a = 0x_10\n", Expect: "underscores"},
+		{Name: "trailing-underscore", Input: "a = 10_\n", Expect: "underscores"},
+		{Name: "double-underscore", Input: "a = 1__0\n", Expect: "underscores"},
+		{Name: "not-a-number", Input: "a = 12ab\n", Expect: "invalid value"},
+		{Name: "overflow", Input: "a = 9223372036854775808\n", Expect: "invalid value"},
+		{Name: "missing-value", Input: "a =\n", Expect: "missing value"},
+		{Name: "missing-equals", Input: "a 1\n", Expect: "expected '='"},
+		{Name: "trailing-garbage", Input: "a = true false\n", Expect: "unexpected trailing characters"},
+		{Name: "duplicate-key", Input: "a = 1\na = 2\n", Expect: "duplicate key"},
+		{Name: "duplicate-table", Input: "[x]\n[x]\n", Expect: "duplicate table"},
+		{Name: "array-of-tables", Input: "[[x]]\n", Expect: "unsupported table header"},
+		{Name: "unterminated-header", Input: "[x\n", Expect: "unterminated table header"},
+		{Name: "unterminated-string", Input: "a = \"x\n", Expect: "unterminated string"},
+		{Name: "unterminated-literal", Input: "a = 'x\n", Expect: "unterminated string"},
+		{Name: "unterminated-array", Input: "a = [1,\n2\n", Expect: "unterminated array"},
+		{Name: "bad-array-separator", Input: "a = [1 2]\n", Expect: "expected ',' or ']'"},
+		{Name: "bad-escape", Input: "a = \"\\q\"\n", Expect: "invalid escape"},
+		{Name: "bad-unicode-escape", Input: "a = \"\\uD800\"\n", Expect: "invalid unicode escape"},
+	}
+
+	for _, row := range testData {
+		t.Run(row.Name, func(t *testing.T) {
+			doc, err := Parse(strings.NewReader(row.Input))
+			if err == nil {
+				t.Fatalf("Parse: expected error containing %q, got %#v", row.Expect, doc)
+			}
+			if !strings.Contains(err.Error(), row.Expect) {
+				t.Errorf("Parse: expected error containing %q, got %q", row.Expect, err.Error())
+			}
+		})
+	}
+}
+
+func TestParseLineNumbers(t *testing.T) {
+	_, err := Parse(strings.NewReader("a = 1\nb = [\n  1,\n]\nc = 010\n"))
+	if err == nil {
+		t.Fatal("Parse: expected error")
+	}
+	if !strings.HasPrefix(err.Error(), "line 5: ") {
+		t.Errorf("Parse: expected error on line 5, got %q", err.Error())
+	}
+}
@@ -0,0 +1,231 @@
+package ignore
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+type Pattern struct {
+	Source  string
+	Negate  bool
+	DirOnly bool
+	rx      *regexp.Regexp
+}
+
+func (pattern Pattern) Matches(relPath string, isDir bool) bool {
+	if pattern.DirOnly && !isDir {
+		return false
+	}
+	return pattern.rx.MatchString(relPath)
+}
+
+func ParsePattern(line string) (Pattern, bool, error) {
+	line = strings.TrimSuffix(line, "\r")
+	line = trimTrailingSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return Pattern{}, false, nil
+	}
+
+	pattern := Pattern{Source: line}
+	if strings.HasPrefix(line, "!") {
+		pattern.Negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") && !strings.HasSuffix(line, "\\/") {
+		pattern.DirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return Pattern{}, false, nil
+	}
+
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	expr, err := translate(norm.NFD.String(line))
+	if err != nil {
+		return Pattern{}, false, fmt.Errorf("invalid pattern %q: %w", pattern.Source, err)
+	}
+	if !anchored {
+		expr = `(?:.*/)?` + expr
+	}
+	pattern.rx, err = regexp.Compile(`^` + expr + `$`)
+	if err != nil {
+		return Pattern{}, false, fmt.Errorf("invalid pattern %q: %w", pattern.Source, err)
+	}
+	return pattern, true, nil
+}
+
+func trimTrailingSpace(line string) string {
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+func translate(input string) (string, error) {
+	var buf strings.Builder
+	runes := []rune(input)
+	n := len(runes)
+	for i := 0; i < n; i++ {
+		ch := runes[i]
+		switch ch {
+		case '\\':
+			i++
+			if i >= n {
+				return "", errors.New("trailing backslash")
+			}
+			buf.WriteString(regexp.QuoteMeta(string(runes[i])))
+
+		case '*':
+			if i+1 < n && runes[i+1] == '*' {
+				atStart := i == 0 || runes[i-1] == '/'
+				j := i + 2
+				switch {
+				case atStart && j >= n:
+					buf.WriteString(`.*`)
+					i = j - 1
+					continue
+				case atStart && runes[j] == '/':
+					buf.WriteString(`(?:.*/)?`)
+					i = j
+					continue
+				}
+			}
+			buf.WriteString(`[^/]*`)
+			for i+1 < n && runes[i+1] == '*' {
+				i++
+			}
+
+		case '?':
+			buf.WriteString(`[^/]`)
+
+		case '[':
+			j := i + 1
+			if j < n && (runes[j] == '!' || runes[j] == '^') {
+				j++
+			}
+			if j < n && runes[j] == ']' {
+				j++
+			}
+			for j < n && runes[j] != ']' {
+				if runes[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= n {
+				return "", errors.New("unterminated character class")
+			}
+			buf.WriteByte('[')
+			k := i + 1
+			if runes[k] == '!' || runes[k] == '^' {
+				buf.WriteByte('^')
+				k++
+			}
+			for ; k < j; k++ {
+				switch r := runes[k]; {
+				case r == '\\':
+					k++
+					buf.WriteString(regexp.QuoteMeta(string(runes[k])))
+				case r == '[' || r == ']':
+					buf.WriteByte('\\')
+					buf.WriteRune(r)
+				default:
+					buf.WriteRune(r)
+				}
+			}
+			buf.WriteByte(']')
+			i = j
+
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	return buf.String(), nil
+}
+
+type Matcher struct {
+	parent   *Matcher
+	dir      string
+	patterns []Pattern
+}
+
+func Load(parent *Matcher, dir string, fileNames []string) (*Matcher, error) {
+	var patterns []Pattern
+	for _, fileName := range fileNames {
+		list, err := ReadFile(filepath.Join(dir, fileName))
+		if err != nil {
+			return parent, err
+		}
+		patterns = append(patterns, list...)
+	}
+	if len(patterns) <= 0 {
+		return parent, nil
+	}
+	return &Matcher{parent: parent, dir: filepath.Clean(dir), patterns: patterns}, nil
+}
+
+func ReadFile(path string) ([]Pattern, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []Pattern
+	s := bufio.NewScanner(f)
+	lineNum := 0
+	for s.Scan() {
+		lineNum++
+		pattern, ok, err := ParsePattern(s.Text())
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNum, err)
+		}
+		if ok {
+			patterns = append(patterns, pattern)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return patterns, nil
+}
+
+func (m *Matcher) Ignored(path string, isDir bool) bool {
+	for level := m; level != nil; level = level.parent {
+		rel, err := filepath.Rel(level.dir, path)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+			continue
+		}
+		rel = norm.NFD.String(filepath.ToSlash(rel))
+		for i := len(level.patterns) - 1; i >= 0; i-- {
+			pattern := level.patterns[i]
+			if pattern.Matches(rel, isDir) {
+				return !pattern.Negate
+			}
+		}
+	}
+	return false
+}
+
+func (m *Matcher) Dirs() []string {
+	var dirs []string
+	for level := m; level != nil; level = level.parent {
+		dirs = append(dirs, level.dir)
+	}
+	slices.Reverse(dirs)
+	return dirs
+}
@@ -0,0 +1,314 @@
+package ignore
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+func TestParsePattern(t *testing.T) {
+	type match struct {
+		Path   string
+		IsDir  bool
+		Expect bool
+	}
+
+	type testCase struct {
+		Line    string
+		Negate  bool
+		DirOnly bool
+		Matches []match
+	}
+
+	testData := [...]testCase{
+		{
+			Line: "*.log",
+			Matches: []match{
+				{Path: "a.log", Expect: true},
+				{Path: "dir/a.log", Expect: true},
+				{Path: "dir/a.log", IsDir: true, Expect: true},
+				{Path: "a.log.txt", Expect: false},
+				{Path: "alog", Expect: false},
+			},
+		},
+		{
+			Line: "/build",
+			Matches: []match{
+				{Path: "build", Expect: true},
+				{Path: "sub/build", Expect: false},
+			},
+		},
+		{
+			Line:    "build/",
+			DirOnly: true,
+			Matches: []match{
+				{Path: "build", IsDir: true, Expect: true},
+				{Path: "sub/build", IsDir: true, Expect: true},
+				{Path: "build", IsDir: false, Expect: false},
+			},
+		},
+		{
+			Line: "doc/*.txt",
+			Matches: []match{
+				{Path: "doc/a.txt", Expect: true},
+				{Path: "doc/sub/a.txt", Expect: false},
+				{Path: "x/doc/a.txt", Expect: false},
+			},
+		},
+		{
+			Line: "**/foo",
+			Matches: []match{
+				{Path: "foo", Expect: true},
+				{Path: "a/foo", Expect: true},
+				{Path: "a/b/foo", Expect: true},
+				{Path: "a/xfoo", Expect: false},
+			},
+		},
+		{
+			Line: "a/**/b",
+			Matches: []match{
+				{Path: "a/b", Expect: true},
+				{Path: "a/x/b", Expect: true},
+				{Path: "a/x/y/b", Expect: true},
+				{Path: "x/a/b", Expect: false},
+			},
+		},
+		{
+			Line: "abc/**",
+			Matches: []match{
+				{Path: "abc/x", Expect: true},
+				{Path: "abc/x/y", Expect: true},
+				{Path: "abc", IsDir: true, Expect: false},
+			},
+		},
+		{
+			Line: "a**b",
+			Matches: []match{
+				{Path: "ab", Expect: true},
+				{Path: "axyb", Expect: true},
+				{Path: "ax/yb", Expect: false},
+			},
+		},
+		{
+			Line: "f?o",
+			Matches: []match{
+				{Path: "foo", Expect: true},
+				{Path: "f/o", Expect: false},
+				{Path: "fo", Expect: false},
+			},
+		},
+		{
+			Line: "[abc].txt",
+			Matches: []match{
+				{Path: "a.txt", Expect: true},
+				{Path: "d.txt", Expect: false},
+			},
+		},
+		{
+			Line: "[!a].txt",
+			Matches: []match{
+				{Path: "a.txt", Expect: false},
+				{Path: "d.txt", Expect: true},
+			},
+		},
+		{
+			Line: "[]x].txt",
+			Matches: []match{
+				{Path: "].txt", Expect: true},
+				{Path: "x.txt", Expect: true},
+				{Path: "y.txt", Expect: false},
+			},
+		},
+		{
+			Line:   "!keep.log",
+			Negate: true,
+			Matches: []match{
+				{Path: "keep.log", Expect: true},
+				{Path: "dir/keep.log", Expect: true},
+			},
+		},
+		{
+			Line: `\#hash`,
+			Matches: []match{
+				{Path: "#hash", Expect: true},
+			},
+		},
+		{
+			Line: `\!bang`,
+			Matches: []match{
+				{Path: "!bang", Expect: true},
+			},
+		},
+		{
+			Line: "a.b+c(d)",
+			Matches: []match{
+				{Path: "a.b+c(d)", Expect: true},
+				{Path: "aXb+c(d)", Expect: false},
+			},
+		},
+		{
+			Line: "trailing   ",
+			Matches: []match{
+				{Path: "trailing", Expect: true},
+				{Path: "trailing ", Expect: false},
+			},
+		},
+		{
+			Line: `space\ `,
+			Matches: []match{
+				{Path: "space ", Expect: true},
+				{Path: "space", Expect: false},
+			},
+		},
+		{
+			Line: "café",
+			Matches: []match{
+				{Path: norm.NFD.String("café"), Expect: true},
+			},
+		},
+	}
+
+	for _, row := range testData {
+		t.Run(row.Line, func(t *testing.T) {
+			pattern, ok, err := ParsePattern(row.Line)
+			if err != nil {
+				t.Fatalf("ParsePattern: unexpected error: %v", err)
+			}
+			if !ok {
+				t.Fatal("ParsePattern: unexpectedly skipped")
+			}
+			if pattern.Negate != row.Negate {
+				t.Errorf("Negate: expected %v, got %v", row.Negate, pattern.Negate)
+			}
+			if pattern.DirOnly != row.DirOnly {
+				t.Errorf("DirOnly: expected %v, got %v", row.DirOnly, pattern.DirOnly)
+			}
+			for _, m := range row.Matches {
+				if actual := pattern.Matches(m.Path, m.IsDir); actual != m.Expect {
+					t.Errorf("Matches(%q, %v): expected %v, got %v", m.Path, m.IsDir, m.Expect, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestParsePatternSkipped(t *testing.T) {
+	for _, line := range [...]string{"", "   ", "# comment", "!", "/", "\r"} {
+		_, ok, err := ParsePattern(line)
+		if err != nil {
+			t.Errorf("ParsePattern(%q): unexpected error: %v", line, err)
+		}
+		if ok {
+			t.Errorf("ParsePattern(%q): expected line to be skipped", line)
+		}
+	}
+}
+
+func TestParsePatternErrors(t *testing.T) {
+	type testCase struct {
+		Line   string
+		Expect string
+	}
+
+	testData := [...]testCase{
+		{Line: "[abc", Expect: "unterminated character class"},
+		{Line: "[]", Expect: "unterminated character class"},
+		{Line: `foo\`, Expect: "trailing backslash"},
+	}
+
+	for _, row := range testData {
+		_, _, err := ParsePattern(row.Line)
+		if err == nil {
+			t.Errorf("ParsePattern(%q): expected error containing %q", row.Line, row.Expect)
+			continue
+		}
+		if !strings.Contains(err.Error(), row.Expect) {
+			t.Errorf("ParsePattern(%q): expected error containing %q, got %q", row.Line, row.Expect, err.Error())
+		}
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	root := t.TempDir()
+	sub := filepath.Join(root, "sub")
+	if err := os.Mkdir(sub, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(root, ".ignore"), "*.log\n!keep.log\nbuild/\n")
+	writeFile(t, filepath.Join(sub, ".ignore"), "*.tmp\n!other.log\n")
+
+	top, err := Load(nil, root, []string{".ignore", ".missing"})
+	if err != nil {
+		t.Fatalf("Load: unexpected error: %v", err)
+	}
+	m, err := Load(top, sub, []string{".ignore"})
+	if err != nil {
+		t.Fatalf("Load: unexpected error: %v", err)
+	}
+
+	empty := filepath.Join(root, "empty")
+	if err := os.Mkdir(empty, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if same, err := Load(m, empty, []string{".ignore"}); err != nil || same != m {
+		t.Errorf("Load: expected parent to be returned for a directory without patterns")
+	}
+
+	type testCase struct {
+		Path   string
+		IsDir  bool
+		Expect bool
+	}
+
+	testData := [...]testCase{
+		{Path: "a.log", Expect: true},
+		{Path: "keep.log", Expect: false},
+		{Path: "a.txt", Expect: false},
+		{Path: "build", IsDir: true, Expect: true},
+		{Path: "build", IsDir: false, Expect: false},
+		{Path: "sub/a.log", Expect: true},
+		{Path: "sub/keep.log", Expect: false},
+		{Path: "sub/a.tmp", Expect: true},
+		{Path: "a.tmp", Expect: false},
+		{Path: "sub/other.log", Expect: false},
+		{Path: "sub/build", IsDir: true, Expect: true},
+	}
+
+	for _, row := range testData {
+		path := filepath.Join(root, filepath.FromSlash(row.Path))
+		if actual := m.Ignored(path, row.IsDir); actual != row.Expect {
+			t.Errorf("Ignored(%q, %v): expected %v, got %v", row.Path, row.IsDir, row.Expect, actual)
+		}
+	}
+
+	if outside := m.Ignored(filepath.Join(filepath.Dir(root), "a.log"), false); outside {
+		t.Errorf("Ignored: paths outside the matcher's directories should never be ignored")
+	}
+
+	dirs := m.Dirs()
+	if len(dirs) != 2 || dirs[0] != root || dirs[1] != sub {
+		t.Errorf("Dirs: expected [%q %q], got %q", root, sub, dirs)
+	}
+}
+
+func TestReadFileErrorLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".ignore")
+	writeFile(t, path, "ok\n# fine\n[bad\n")
+	_, err := ReadFile(path)
+	if err == nil {
+		t.Fatal("ReadFile: expected error")
+	}
+	if !strings.Contains(err.Error(), path+":3:") {
+		t.Errorf("ReadFile: expected error to name line 3, got %q", err.Error())
+	}
+}
+
+func writeFile(t *testing.T, path string, contents string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(contents), 0o666); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,30 @@
+package interrupt
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Watch returns a context that is cancelled on the first SIGINT or SIGTERM.
+// The handler is removed once it fires, so a second signal kills the process.
+func Watch() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		defer signal.Stop(ch)
+		select {
+		case sig := <-ch:
+			log.Logger.Warn().
+				Stringer("signal", sig).
+				Msg("interrupted; finishing current work before exiting")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
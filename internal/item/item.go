@@ -1,6 +1,7 @@
 package item
 
 import (
+	"errors"
 	"io/fs"
 	"os"
 	"path/filepath"
@@ -8,8 +9,14 @@ import (
 	"time"
 
 	"github.com/rs/zerolog/log"
+
+	"github.com/chronos-tachyon/go-dedupe/internal/throttle"
 )
 
+// NoAtime requests that Open avoid updating access times where the platform
+// allows it.  Files the process does not own are opened normally.
+var NoAtime bool
+
 func UnixTime(t time.Time) int64 {
 	return t.Truncate(time.Second).Unix()
 }
@@ -24,14 +31,16 @@ type Item struct {
 	Dev       uint64
 	Ino       uint64
 	Nlink     uint64
+	Blocks    int64
 	Priority  uint
 	IsSymlink bool
+	IsRef     bool
 }
 
 func Open(path string) *Item {
 	path = filepath.Clean(path)
 
-	f, err := os.Open(path)
+	f, err := openFile(path)
 	if err != nil {
 		log.Logger.Error().
 			Str("path", path).
@@ -60,10 +69,21 @@ func Open(path string) *Item {
 		item.Dev = x.Dev
 		item.Ino = x.Ino
 		item.Nlink = uint64(x.Nlink)
+		item.Blocks = int64(x.Blocks)
 	}
 	return &item
 }
 
+func openFile(path string) (*os.File, error) {
+	if NoAtime && noatimeFlag != 0 {
+		f, err := os.OpenFile(path, os.O_RDONLY|noatimeFlag, 0)
+		if !errors.Is(err, fs.ErrPermission) {
+			return f, err
+		}
+	}
+	return os.Open(path)
+}
+
 func (item *Item) Close() {
 	if item == nil {
 		return
@@ -72,6 +92,9 @@ func (item *Item) Close() {
 	f := item.File
 	item.File = nil
 	if f != nil {
+		if item.Mode.IsRegular() {
+			throttle.DropCache(f)
+		}
 		if err := f.Close(); err != nil {
 			log.Logger.Error().
 				Str("path", item.Path).
@@ -0,0 +1,7 @@
+//go:build linux
+
+package item
+
+import "syscall"
+
+const noatimeFlag = syscall.O_NOATIME
@@ -0,0 +1,5 @@
+//go:build !linux
+
+package item
+
+const noatimeFlag = 0
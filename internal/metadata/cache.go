@@ -0,0 +1,260 @@
+package metadata
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/chronos-tachyon/go-dedupe/internal/item"
+)
+
+const cacheHeader = "# go-dedupe metadata cache v1"
+
+type cacheRecord struct {
+	Dev  uint64
+	Ino  uint64
+	Meta Metadata
+}
+
+type CacheStore struct {
+	mu     sync.Mutex
+	path   string
+	byPath map[string]cacheRecord
+	dirty  bool
+}
+
+func DefaultCachePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "go-dedupe", "metadata.cache")
+}
+
+func OpenCacheStore(path string) (*CacheStore, error) {
+	if path == "" {
+		return nil, errors.New("no metadata cache path specified")
+	}
+
+	store := &CacheStore{
+		path:   path,
+		byPath: make(map[string]cacheRecord, 1<<16),
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 0, 1<<16), 1<<20)
+	lineNum := 0
+	for s.Scan() {
+		lineNum++
+		line := s.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !store.decodeLine(line) {
+			log.Logger.Warn().
+				Str("path", path).
+				Int("line", lineNum).
+				Msg("failed to decode metadata cache entry")
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func (store *CacheStore) decodeLine(line string) bool {
+	pieces := strings.SplitN(line, " ", 4)
+	if len(pieces) != 4 {
+		return false
+	}
+
+	dev, err := strconv.ParseUint(pieces[0], 10, 64)
+	if err != nil {
+		return false
+	}
+	ino, err := strconv.ParseUint(pieces[1], 10, 64)
+	if err != nil {
+		return false
+	}
+	path, err := strconv.Unquote(pieces[3])
+	if err != nil {
+		return false
+	}
+
+	var meta Metadata
+	if !meta.Decode([]byte(pieces[2])) {
+		return false
+	}
+
+	store.byPath[path] = cacheRecord{Dev: dev, Ino: ino, Meta: meta}
+	return true
+}
+
+func (store *CacheStore) Load(it *item.Item, meta *Metadata) bool {
+	key := cacheKey(it.Path)
+
+	store.mu.Lock()
+	record, found := store.byPath[key]
+	store.mu.Unlock()
+
+	if !found {
+		return false
+	}
+	if record.Dev != it.Dev || record.Ino != it.Ino || !record.Meta.Check(it.Size, it.Time) {
+		store.mu.Lock()
+		if store.byPath[key] == record {
+			delete(store.byPath, key)
+			store.dirty = true
+		}
+		store.mu.Unlock()
+		return false
+	}
+	*meta = record.Meta
+	return true
+}
+
+func (store *CacheStore) Save(it *item.Item, meta Metadata) bool {
+	key := cacheKey(it.Path)
+	record := cacheRecord{Dev: it.Dev, Ino: it.Ino, Meta: meta}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if existing, found := store.byPath[key]; !found || existing != record {
+		store.byPath[key] = record
+		store.dirty = true
+	}
+	return true
+}
+
+func (store *CacheStore) Close() error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if !store.dirty {
+		return nil
+	}
+	store.prune()
+
+	dir := filepath.Dir(store.path)
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(dir, filepath.Base(store.path)+".*")
+	if err != nil {
+		return err
+	}
+	tempPath := f.Name()
+	needRemove := true
+	defer func() {
+		if needRemove {
+			_ = os.Remove(tempPath)
+		}
+	}()
+
+	w := bufio.NewWriter(f)
+	_, _ = w.WriteString(cacheHeader)
+	_ = w.WriteByte('\n')
+	paths := make([]string, 0, len(store.byPath))
+	for path := range store.byPath {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var scratch []byte
+	for _, path := range paths {
+		record := store.byPath[path]
+		scratch = strconv.AppendUint(scratch[:0], record.Dev, 10)
+		scratch = append(scratch, ' ')
+		scratch = strconv.AppendUint(scratch, record.Ino, 10)
+		scratch = append(scratch, ' ')
+		scratch = record.Meta.Append(scratch)
+		scratch = append(scratch, ' ')
+		scratch = strconv.AppendQuote(scratch, path)
+		scratch = append(scratch, '\n')
+		_, _ = w.Write(scratch)
+	}
+
+	err = w.Flush()
+	if err == nil {
+		err = f.Close()
+	} else {
+		_ = f.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write metadata cache: %w", err)
+	}
+
+	if err := os.Rename(tempPath, store.path); err != nil {
+		return err
+	}
+	needRemove = false
+	store.dirty = false
+	return nil
+}
+
+// prune drops the records of files that have been deleted or replaced.  A
+// missing file only counts as deleted if its nearest surviving ancestor is on
+// the same device, so that the records for an unmounted filesystem are kept.
+func (store *CacheStore) prune() {
+	for path, record := range store.byPath {
+		dev, ino, err := statDevIno(path)
+		switch {
+		case err == nil && (dev != record.Dev || ino != record.Ino):
+			delete(store.byPath, path)
+		case errors.Is(err, fs.ErrNotExist) && ancestorDev(path) == record.Dev:
+			delete(store.byPath, path)
+		}
+	}
+}
+
+func ancestorDev(path string) uint64 {
+	for {
+		parent := filepath.Dir(path)
+		if parent == path {
+			return 0
+		}
+		path = parent
+		if dev, _, err := statDevIno(path); err == nil {
+			return dev
+		}
+	}
+}
+
+func statDevIno(path string) (uint64, uint64, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	if x, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return x.Dev, x.Ino, nil
+	}
+	return 0, 0, errors.New("device and inode numbers are not available")
+}
+
+func cacheKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
@@ -0,0 +1,208 @@
+package metadata
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chronos-tachyon/go-dedupe/internal/item"
+)
+
+func testMetadata(it *item.Item, fill byte) Metadata {
+	meta := Metadata{Bits: AllBits, Size: it.Size, Time: it.Time}
+	for i := range meta.MD5 {
+		meta.MD5[i] = fill
+	}
+	for i := range meta.SHA1 {
+		meta.SHA1[i] = fill + 1
+	}
+	for i := range meta.SHA256 {
+		meta.SHA256[i] = fill + 2
+	}
+	return meta
+}
+
+func createFile(t *testing.T, path string, contents string) *item.Item {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(contents), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	it := item.Open(path)
+	if it == nil {
+		t.Fatalf("failed to open %q", path)
+	}
+	t.Cleanup(it.Close)
+	return it
+}
+
+func openCache(t *testing.T, path string) *CacheStore {
+	t.Helper()
+	store, err := OpenCacheStore(path)
+	if err != nil {
+		t.Fatalf("OpenCacheStore: unexpected error: %v", err)
+	}
+	return store
+}
+
+func TestCacheStoreRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "cache", "metadata.cache")
+
+	plain := createFile(t, filepath.Join(dir, "plain"), "hello\n")
+	odd := createFile(t, filepath.Join(dir, "with \"quotes\" and spaces\n"), "world\n")
+	plainMeta := testMetadata(plain, 0x10)
+	oddMeta := testMetadata(odd, 0x20)
+
+	store := openCache(t, cachePath)
+	if !store.Save(plain, plainMeta) || !store.Save(odd, oddMeta) {
+		t.Fatal("Save: unexpected failure")
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close: unexpected error: %v", err)
+	}
+
+	store = openCache(t, cachePath)
+	for _, row := range [...]struct {
+		it     *item.Item
+		expect Metadata
+	}{
+		{plain, plainMeta},
+		{odd, oddMeta},
+	} {
+		var actual Metadata
+		if !store.Load(row.it, &actual) {
+			t.Errorf("Load(%q): expected a cached record", row.it.Path)
+			continue
+		}
+		if actual != row.expect {
+			t.Errorf("Load(%q): wrong metadata\n\texpect: %v\n\tactual: %v", row.it.Path, row.expect, actual)
+		}
+	}
+	if store.dirty {
+		t.Error("Load: clean loads should not mark the cache dirty")
+	}
+}
+
+func TestCacheStoreSkipsBadLines(t *testing.T) {
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "metadata.cache")
+	it := createFile(t, filepath.Join(dir, "file"), "hello\n")
+	meta := testMetadata(it, 0x30)
+
+	store := openCache(t, cachePath)
+	store.Save(it, meta)
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw = append(raw, "garbage\n1 2 size:1 unquoted\n\n# comment\n"...)
+	if err := os.WriteFile(cachePath, raw, 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	store = openCache(t, cachePath)
+	if len(store.byPath) != 1 {
+		t.Errorf("OpenCacheStore: expected 1 record, got %d", len(store.byPath))
+	}
+	var actual Metadata
+	if !store.Load(it, &actual) || actual != meta {
+		t.Errorf("Load: expected the valid record to survive, got %v", actual)
+	}
+}
+
+func TestCacheStoreDropsStaleRecords(t *testing.T) {
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "metadata.cache")
+	path := filepath.Join(dir, "file")
+	keepPath := filepath.Join(dir, "keep")
+
+	it := createFile(t, path, "hello\n")
+	keep := createFile(t, keepPath, "keep\n")
+	store := openCache(t, cachePath)
+	store.Save(it, testMetadata(it, 0x40))
+	store.Save(keep, testMetadata(keep, 0x50))
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	changed := createFile(t, path, "hello, world\n")
+	store = openCache(t, cachePath)
+	var meta Metadata
+	if store.Load(changed, &meta) {
+		t.Fatal("Load: expected a record for a changed file to be rejected")
+	}
+	if _, found := store.byPath[cacheKey(path)]; found {
+		t.Error("Load: expected the stale record to be dropped")
+	}
+	if !store.dirty {
+		t.Error("Load: expected dropping a record to mark the cache dirty")
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store = openCache(t, cachePath)
+	if _, found := store.byPath[cacheKey(path)]; found {
+		t.Error("Close: expected the stale record not to be written back")
+	}
+	if !store.Load(keep, &meta) {
+		t.Error("Close: expected the unrelated record to be kept")
+	}
+}
+
+func TestCacheStorePrunesDeletedFiles(t *testing.T) {
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "metadata.cache")
+	gonePath := filepath.Join(dir, "gone")
+	replacedPath := filepath.Join(dir, "replaced")
+
+	gone := createFile(t, gonePath, "gone\n")
+	replaced := createFile(t, replacedPath, "replaced\n")
+	store := openCache(t, cachePath)
+	store.Save(gone, testMetadata(gone, 0x60))
+	store.Save(replaced, testMetadata(replaced, 0x70))
+
+	// A record under a directory that no longer exists, on a device that
+	// does not match, stands in for a file on an unmounted filesystem.
+	unmounted := filepath.Join(dir, "mnt", "file")
+	store.byPath[unmounted] = cacheRecord{Dev: replaced.Dev + 1, Ino: 1, Meta: testMetadata(gone, 0x80)}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(gonePath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(replacedPath); err != nil {
+		t.Fatal(err)
+	}
+	// Keep the old inode alive so the new file cannot reuse its number.
+	fresh := createFile(t, replacedPath, "replaced\n")
+	if fresh.Ino == replaced.Ino {
+		t.Skip("filesystem reused the inode number")
+	}
+
+	store = openCache(t, cachePath)
+	other := createFile(t, filepath.Join(dir, "other"), "other\n")
+	store.Save(other, testMetadata(other, 0x90))
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store = openCache(t, cachePath)
+	for _, path := range [...]string{gonePath, replacedPath} {
+		if _, found := store.byPath[cacheKey(path)]; found {
+			t.Errorf("Close: expected the record for %q to be pruned", path)
+		}
+	}
+	if _, found := store.byPath[unmounted]; !found {
+		t.Error("Close: expected the record on another device to be kept")
+	}
+	if _, found := store.byPath[cacheKey(other.Path)]; !found {
+		t.Error("Close: expected the new record to be written")
+	}
+}
@@ -15,6 +15,8 @@ import (
 	"strconv"
 
 	"github.com/rs/zerolog/log"
+
+	"github.com/chronos-tachyon/go-dedupe/internal/throttle"
 )
 
 var (
@@ -104,52 +106,57 @@ func (meta *Metadata) Decode(input []byte) bool {
 	return meta.Bits.HasAll(AllBits)
 }
 
-func (meta *Metadata) decodeSize(raw []byte) {
+func (meta *Metadata) decodeSize(raw []byte) bool {
 	if i64, ok := decodeInt(raw); ok {
 		meta.Size = i64
 		meta.Bits |= SizeBit
-		return
+		return true
 	}
 	log.Logger.Warn().Bytes("value", raw).Msg("failed to decode size")
+	return false
 }
 
-func (meta *Metadata) decodeModTime(raw []byte) {
+func (meta *Metadata) decodeModTime(raw []byte) bool {
 	if i64, ok := decodeInt(raw); ok {
 		meta.Time = i64
 		meta.Bits |= TimeBit
-		return
+		return true
 	}
 	log.Logger.Warn().Bytes("value", raw).Msg("failed to decode last modified time")
+	return false
 }
 
-func (meta *Metadata) decodeMD5(raw []byte) {
+func (meta *Metadata) decodeMD5(raw []byte) bool {
 	var sum MD5Sum
 	if decodeHash(sum[:], raw) {
 		meta.MD5 = sum
 		meta.Bits |= MD5Bit
-		return
+		return true
 	}
 	log.Logger.Warn().Bytes("value", raw).Msg("failed to decode MD5 hash")
+	return false
 }
 
-func (meta *Metadata) decodeSHA1(raw []byte) {
+func (meta *Metadata) decodeSHA1(raw []byte) bool {
 	var sum SHA1Sum
 	if decodeHash(sum[:], raw) {
 		meta.SHA1 = sum
 		meta.Bits |= SHA1Bit
-		return
+		return true
 	}
 	log.Logger.Warn().Bytes("value", raw).Msg("failed to decode SHA1 hash")
+	return false
 }
 
-func (meta *Metadata) decodeSHA256(raw []byte) {
+func (meta *Metadata) decodeSHA256(raw []byte) bool {
 	var sum SHA256Sum
 	if decodeHash(sum[:], raw) {
 		meta.SHA256 = sum
 		meta.Bits |= SHA256Bit
-		return
+		return true
 	}
 	log.Logger.Warn().Bytes("value", raw).Msg("failed to decode SHA256 hash")
+	return false
 }
 
 func decodeInt(input []byte) (int64, bool) {
@@ -170,19 +177,30 @@ func decodeHash(output []byte, input []byte) bool {
 		copy(output, input)
 		return true
 	}
-	if inputLen >= hex.EncodedLen(outputLen) {
-		n, err := hex.Decode(output, input)
+
+	// Decode into scratch space sized for the input, since the encoders
+	// write past the end of a buffer sized for a well-formed hash.
+	var scratch []byte
+	decode := func(fn func([]byte, []byte) (int, error), size int) bool {
+		if cap(scratch) < size {
+			scratch = make([]byte, size)
+		}
+		n, err := fn(scratch[:size], input)
 		if n == outputLen && err == nil {
+			copy(output, scratch[:n])
 			return true
 		}
+		return false
+	}
+
+	if inputLen >= hex.EncodedLen(outputLen) && decode(hex.Decode, hex.DecodedLen(inputLen)) {
+		return true
 	}
 	if inputLen >= base64.StdEncoding.EncodedLen(outputLen) {
-		n, err := base64.StdEncoding.Decode(output, input)
-		if n == outputLen && err == nil {
+		if decode(base64.StdEncoding.Decode, base64.StdEncoding.DecodedLen(inputLen)) {
 			return true
 		}
-		n, err = base64.URLEncoding.Decode(output, input)
-		if n == outputLen && err == nil {
+		if decode(base64.URLEncoding.Decode, base64.URLEncoding.DecodedLen(inputLen)) {
 			return true
 		}
 	}
@@ -198,6 +216,9 @@ func (meta *Metadata) Compute(file *os.File, size int64, modTime int64) bool {
 		return false
 	}
 
+	throttle.Sequential(file)
+	r := throttle.NewReader(file)
+
 	var computedSize int64
 	md5Hasher := md5.New()
 	sha1Hasher := sha1.New()
@@ -205,7 +226,7 @@ func (meta *Metadata) Compute(file *os.File, size int64, modTime int64) bool {
 
 	for {
 		var buf [1 << 16]byte
-		n, err := file.Read(buf[:])
+		n, err := r.Read(buf[:])
 		if n > 0 {
 			p := buf[:n]
 			computedSize += int64(n)
@@ -245,14 +266,15 @@ func (meta *Metadata) Compute(file *os.File, size int64, modTime int64) bool {
 	return true
 }
 
-func (meta Metadata) Save(file *os.File, names Names) {
+func (meta Metadata) Save(file *os.File, names Names) bool {
 	var scratch [64]byte
-	MaybeFSet(file, names.Stamp, meta.Append(scratch[:0]))
-	MaybeFSet(file, names.Size, appendInt(scratch[:0], meta.Size))
-	MaybeFSet(file, names.Time, appendInt(scratch[:0], meta.Time))
-	MaybeFSet(file, names.MD5, appendHash(scratch[:0], true, meta.MD5[:]))
-	MaybeFSet(file, names.SHA1, appendHash(scratch[:0], true, meta.SHA1[:]))
-	MaybeFSet(file, names.SHA256, appendHash(scratch[:0], true, meta.SHA256[:]))
+	ok := MaybeFSet(file, names.Stamp, meta.Append(scratch[:0]))
+	ok = MaybeFSet(file, names.Size, appendInt(scratch[:0], meta.Size)) && ok
+	ok = MaybeFSet(file, names.Time, appendInt(scratch[:0], meta.Time)) && ok
+	ok = MaybeFSet(file, names.MD5, appendHash(scratch[:0], true, meta.MD5[:])) && ok
+	ok = MaybeFSet(file, names.SHA1, appendHash(scratch[:0], true, meta.SHA1[:])) && ok
+	ok = MaybeFSet(file, names.SHA256, appendHash(scratch[:0], true, meta.SHA256[:])) && ok
+	return ok
 }
 
 func (meta Metadata) Append(out []byte) []byte {
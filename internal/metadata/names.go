@@ -1,21 +1,23 @@
 package metadata
 
 type Names struct {
-	Stamp  string
-	Size   string
-	Time   string
-	MD5    string
-	SHA1   string
-	SHA256 string
+	Stamp   string
+	Size    string
+	Time    string
+	MD5     string
+	SHA1    string
+	SHA256  string
+	Partial string
 }
 
 func DefaultNames() Names {
 	return Names{
-		Stamp:  "user.dedupe.stamp",
-		Size:   "user.size",
-		Time:   "user.mtime",
-		MD5:    "user.md5sum",
-		SHA1:   "user.sha1sum",
-		SHA256: "user.sha256sum",
+		Stamp:   "user.dedupe.stamp",
+		Size:    "user.size",
+		Time:    "user.mtime",
+		MD5:     "user.md5sum",
+		SHA1:    "user.sha1sum",
+		SHA256:  "user.sha256sum",
+		Partial: "user.dedupe.partial",
 	}
 }
@@ -0,0 +1,143 @@
+package metadata
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/chronos-tachyon/go-dedupe/internal/throttle"
+)
+
+var kBlock = []byte("block")
+
+type Partial struct {
+	Size   int64
+	Time   int64
+	Block  int64
+	SHA256 SHA256Sum
+	OK     bool
+}
+
+func (p *Partial) Reset() {
+	*p = Partial{}
+}
+
+func (p Partial) Check(size int64, modTime int64, block int64) bool {
+	return p.OK && p.Size == size && p.Time == modTime && p.Block == block
+}
+
+func (p *Partial) Load(file *os.File, name string) bool {
+	p.Reset()
+	if raw, ok := MaybeFGet(file, name); ok {
+		return p.Decode(raw)
+	}
+	return false
+}
+
+func (p *Partial) Decode(input []byte) bool {
+	var bits Bits
+	var block bool
+	for _, raw := range bytes.Split(input, kSplit) {
+		key, value, found := bytes.Cut(raw, kCut)
+		switch {
+		case found && bytes.EqualFold(key, kSize):
+			if i64, ok := decodeInt(value); ok {
+				p.Size = i64
+				bits |= SizeBit
+			}
+		case found && bytes.EqualFold(key, kModTime):
+			if i64, ok := decodeInt(value); ok {
+				p.Time = i64
+				bits |= TimeBit
+			}
+		case found && bytes.EqualFold(key, kBlock):
+			if i64, ok := decodeInt(value); ok {
+				p.Block = i64
+				block = true
+			}
+		case found && bytes.EqualFold(key, kSHA256):
+			if decodeHash(p.SHA256[:], value) {
+				bits |= SHA256Bit
+			}
+		}
+	}
+	p.OK = block && bits.HasAll(SizeBit|TimeBit|SHA256Bit)
+	if !p.OK {
+		log.Logger.Warn().Bytes("value", input).Msg("failed to decode partial hash")
+	}
+	return p.OK
+}
+
+func (p *Partial) Compute(file *os.File, size int64, modTime int64, block int64) bool {
+	p.Reset()
+
+	hasher := sha256.New()
+	head := io.NewSectionReader(file, 0, min(block, size))
+	if !copyPartial(hasher, head, file.Name(), 0) {
+		return false
+	}
+	if tailStart := max(block, size-block); tailStart < size {
+		tail := io.NewSectionReader(file, tailStart, size-tailStart)
+		if !copyPartial(hasher, tail, file.Name(), tailStart) {
+			return false
+		}
+	}
+
+	p.Size = size
+	p.Time = modTime
+	p.Block = block
+	_ = hasher.Sum(p.SHA256[:0])
+	p.OK = true
+	return true
+}
+
+func copyPartial(w io.Writer, r *io.SectionReader, path string, offset int64) bool {
+	n, err := io.Copy(w, throttle.NewReader(r))
+	if err == nil && n < r.Size() {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		log.Logger.Error().
+			Str("path", path).
+			Int64("offset", offset+n).
+			Err(err).
+			Msg("I/O error while reading file")
+		return false
+	}
+	return true
+}
+
+func (p Partial) Save(file *os.File, name string) bool {
+	var scratch [128]byte
+	return MaybeFSet(file, name, p.Append(scratch[:0]))
+}
+
+func (p Partial) Append(out []byte) []byte {
+	out = append(out, kSize...)
+	out = append(out, kCut...)
+	out = appendInt(out, p.Size)
+	out = append(out, kSplit...)
+	out = append(out, kModTime...)
+	out = append(out, kCut...)
+	out = appendInt(out, p.Time)
+	out = append(out, kSplit...)
+	out = append(out, kBlock...)
+	out = append(out, kCut...)
+	out = appendInt(out, p.Block)
+	out = append(out, kSplit...)
+	out = append(out, kSHA256...)
+	out = append(out, kCut...)
+	out = appendHash(out, false, p.SHA256[:])
+	return out
+}
+
+func (p Partial) String() string {
+	var scratch [128]byte
+	return string(p.Append(scratch[:0]))
+}
+
+var _ fmt.Stringer = Partial{}
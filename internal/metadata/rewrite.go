@@ -0,0 +1,163 @@
+package metadata
+
+import (
+	"bytes"
+	"os"
+
+	"github.com/rs/zerolog/log"
+)
+
+type RewriteStats struct {
+	Changed uint
+	Removed uint
+}
+
+func (stats RewriteStats) Any() bool {
+	return stats.Changed != 0 || stats.Removed != 0
+}
+
+func (stats *RewriteStats) Add(other RewriteStats) {
+	stats.Changed += other.Changed
+	stats.Removed += other.Removed
+}
+
+type rewriteField struct {
+	name   string
+	bit    Bits
+	decode func(*Metadata, []byte) bool
+	encode func(Metadata, []byte) []byte
+}
+
+func rewriteFields(names Names) [5]rewriteField {
+	return [5]rewriteField{
+		{
+			name:   names.Size,
+			bit:    SizeBit,
+			decode: (*Metadata).decodeSize,
+			encode: func(meta Metadata, out []byte) []byte { return appendInt(out, meta.Size) },
+		},
+		{
+			name:   names.Time,
+			bit:    TimeBit,
+			decode: (*Metadata).decodeModTime,
+			encode: func(meta Metadata, out []byte) []byte { return appendInt(out, meta.Time) },
+		},
+		{
+			name:   names.MD5,
+			bit:    MD5Bit,
+			decode: (*Metadata).decodeMD5,
+			encode: func(meta Metadata, out []byte) []byte { return appendHash(out, true, meta.MD5[:]) },
+		},
+		{
+			name:   names.SHA1,
+			bit:    SHA1Bit,
+			decode: (*Metadata).decodeSHA1,
+			encode: func(meta Metadata, out []byte) []byte { return appendHash(out, true, meta.SHA1[:]) },
+		},
+		{
+			name:   names.SHA256,
+			bit:    SHA256Bit,
+			decode: (*Metadata).decodeSHA256,
+			encode: func(meta Metadata, out []byte) []byte { return appendHash(out, true, meta.SHA256[:]) },
+		},
+	}
+}
+
+func (meta *Metadata) merge(other Metadata, bit Bits) {
+	switch bit {
+	case SizeBit:
+		meta.Size = other.Size
+	case TimeBit:
+		meta.Time = other.Time
+	case MD5Bit:
+		meta.MD5 = other.MD5
+	case SHA1Bit:
+		meta.SHA1 = other.SHA1
+	case SHA256Bit:
+		meta.SHA256 = other.SHA256
+	}
+	meta.Bits |= bit
+}
+
+func Rewrite(file *os.File, names Names) RewriteStats {
+	var stats RewriteStats
+	var meta Metadata
+
+	stampRaw, hasStamp := MaybeFGet(file, names.Stamp)
+	if hasStamp {
+		meta.Decode(stampRaw)
+	}
+
+	fields := rewriteFields(names)
+	var present Bits
+	for _, field := range fields {
+		raw, ok := MaybeFGet(file, field.name)
+		if !ok {
+			continue
+		}
+		var tmp Metadata
+		if !field.decode(&tmp, raw) {
+			stats.remove(file, field.name, raw)
+			continue
+		}
+		present |= field.bit
+		if !meta.Bits.Has(field.bit) {
+			meta.merge(tmp, field.bit)
+		}
+	}
+
+	var scratch [128]byte
+	if meta.Bits.HasAll(AllBits) {
+		stats.rewrite(file, names.Stamp, stampRaw, meta.Append(scratch[:0]))
+		present = AllBits
+	} else if hasStamp {
+		stats.remove(file, names.Stamp, stampRaw)
+	}
+
+	for _, field := range fields {
+		if !present.Has(field.bit) {
+			continue
+		}
+		raw, _ := MaybeFGet(file, field.name)
+		stats.rewrite(file, field.name, raw, field.encode(meta, scratch[:0]))
+	}
+
+	if raw, ok := MaybeFGet(file, names.Partial); ok {
+		var partial Partial
+		if partial.Decode(raw) {
+			stats.rewrite(file, names.Partial, raw, partial.Append(scratch[:0]))
+		} else {
+			stats.remove(file, names.Partial, raw)
+		}
+	}
+
+	return stats
+}
+
+func (stats *RewriteStats) rewrite(file *os.File, name string, oldValue []byte, newValue []byte) {
+	if bytes.Equal(oldValue, newValue) {
+		return
+	}
+	if !MaybeFSet(file, name, newValue) {
+		return
+	}
+	log.Logger.Info().
+		Str("path", file.Name()).
+		Str("xaName", name).
+		Bytes("oldValue", oldValue).
+		Bytes("newValue", newValue).
+		Msg("rewrote metadata")
+	stats.Changed++
+}
+
+func (stats *RewriteStats) remove(file *os.File, name string, oldValue []byte) {
+	if !MaybeFRemove(file, name) {
+		return
+	}
+	log.Logger.Info().
+		Str("path", file.Name()).
+		Str("xaName", name).
+		Bytes("oldValue", oldValue).
+		Msg("removed malformed metadata")
+	stats.Removed++
+}
@@ -0,0 +1,338 @@
+package metadata
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/pkg/xattr"
+)
+
+var (
+	helloMD5    = md5.Sum([]byte("hello\n"))
+	helloSHA1   = sha1.Sum([]byte("hello\n"))
+	helloSHA256 = sha256.Sum256([]byte("hello\n"))
+)
+
+func helloMetadata() Metadata {
+	return Metadata{
+		Bits:   AllBits,
+		Size:   6,
+		Time:   1700000000,
+		MD5:    helloMD5,
+		SHA1:   helloSHA1,
+		SHA256: helloSHA256,
+	}
+}
+
+func TestDecode(t *testing.T) {
+	b64 := base64.StdEncoding.EncodeToString
+	url := base64.URLEncoding.EncodeToString
+	var binarySize [8]byte
+	binary.BigEndian.PutUint64(binarySize[:], 6)
+
+	type testCase struct {
+		Name   string
+		Input  string
+		Expect Metadata
+		OK     bool
+	}
+
+	testData := [...]testCase{
+		{
+			Name:   "canonical",
+			Input:  helloMetadata().String(),
+			Expect: helloMetadata(),
+			OK:     true,
+		},
+		{
+			Name: "hex",
+			Input: "size:6,modTime:1700000000" +
+				",md5:" + hex.EncodeToString(helloMD5[:]) +
+				",sha1:" + hex.EncodeToString(helloSHA1[:]) +
+				",sha256:" + hex.EncodeToString(helloSHA256[:]),
+			Expect: helloMetadata(),
+			OK:     true,
+		},
+		{
+			Name: "url-base64-and-mixed-case-keys",
+			Input: "SIZE:6,modtime:1700000000" +
+				",MD5:" + url(helloMD5[:]) +
+				",Sha1:" + url(helloSHA1[:]) +
+				",sha256:" + url(helloSHA256[:]),
+			Expect: helloMetadata(),
+			OK:     true,
+		},
+		{
+			Name: "raw-bytes-and-binary-int",
+			Input: "size:" + string(binarySize[:]) + ",modTime:1700000000" +
+				",md5:" + string(helloMD5[:]) +
+				",sha1:" + b64(helloSHA1[:]) +
+				",sha256:" + b64(helloSHA256[:]),
+			Expect: helloMetadata(),
+			OK:     true,
+		},
+		{
+			Name:  "incomplete",
+			Input: "size:6,modTime:1700000000",
+			Expect: Metadata{
+				Bits: SizeBit | TimeBit,
+				Size: 6,
+				Time: 1700000000,
+			},
+			OK: false,
+		},
+		{
+			Name:  "malformed-hash",
+			Input: "size:6,modTime:1700000000,md5:zz,sha1:" + b64(helloSHA1[:]) + ",sha256:" + b64(helloSHA256[:]),
+			Expect: Metadata{
+				Bits:   SizeBit | TimeBit | SHA1Bit | SHA256Bit,
+				Size:   6,
+				Time:   1700000000,
+				SHA1:   helloSHA1,
+				SHA256: helloSHA256,
+			},
+			OK: false,
+		},
+		{
+			Name:  "truncated-hash",
+			Input: "sha256:" + hex.EncodeToString(helloSHA256[:31]),
+			OK:    false,
+		},
+		{
+			Name:  "overlong-hex",
+			Input: "sha256:" + hex.EncodeToString(helloSHA256[:]) + "00",
+			OK:    false,
+		},
+		{
+			Name:  "overlong-base64",
+			Input: "md5:" + b64(helloSHA256[:]),
+			OK:    false,
+		},
+		{
+			Name:  "unknown-keys-and-junk",
+			Input: "foo:bar,,nocolon,size:six",
+			OK:    false,
+		},
+	}
+
+	for _, row := range testData {
+		t.Run(row.Name, func(t *testing.T) {
+			var actual Metadata
+			ok := actual.Decode([]byte(row.Input))
+			if ok != row.OK {
+				t.Errorf("Decode: expected %v, got %v", row.OK, ok)
+			}
+			if actual != row.Expect {
+				t.Errorf("Decode: wrong result\n\texpect: %#v\n\tactual: %#v", row.Expect, actual)
+			}
+		})
+	}
+}
+
+func TestPartialDecode(t *testing.T) {
+	canonical := Partial{Size: 100, Time: 1700000000, Block: 16, SHA256: helloSHA256, OK: true}
+
+	type testCase struct {
+		Name   string
+		Input  string
+		Expect bool
+	}
+
+	testData := [...]testCase{
+		{Name: "canonical", Input: canonical.String(), Expect: true},
+		{Name: "hex", Input: "size:100,modTime:1700000000,block:16,sha256:" + hex.EncodeToString(helloSHA256[:]), Expect: true},
+		{Name: "missing-block", Input: "size:100,modTime:1700000000,sha256:" + hex.EncodeToString(helloSHA256[:]), Expect: false},
+		{Name: "malformed-hash", Input: "size:100,modTime:1700000000,block:16,sha256:nope", Expect: false},
+	}
+
+	for _, row := range testData {
+		t.Run(row.Name, func(t *testing.T) {
+			var actual Partial
+			if ok := actual.Decode([]byte(row.Input)); ok != row.Expect {
+				t.Fatalf("Decode: expected %v, got %v", row.Expect, ok)
+			}
+			if row.Expect && actual != canonical {
+				t.Errorf("Decode: wrong result\n\texpect: %#v\n\tactual: %#v", canonical, actual)
+			}
+		})
+	}
+}
+
+func xattrFile(t *testing.T, attrs map[string]string) *os.File {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, []byte("hello\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+
+	if err := xattr.FSet(f, "user.test", []byte("x")); err != nil {
+		if errors.Is(err, syscall.ENOTSUP) || errors.Is(err, syscall.EPERM) {
+			t.Skipf("user xattrs are not supported here: %v", err)
+		}
+		t.Fatal(err)
+	}
+	if err := xattr.FRemove(f, "user.test"); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, value := range attrs {
+		if err := xattr.FSet(f, name, []byte(value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return f
+}
+
+func readXattrs(t *testing.T, f *os.File) map[string]string {
+	t.Helper()
+	names, err := xattr.FList(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make(map[string]string, len(names))
+	for _, name := range names {
+		value, err := xattr.FGet(f, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out[name] = string(value)
+	}
+	return out
+}
+
+func TestRewrite(t *testing.T) {
+	names := DefaultNames()
+	meta := helloMetadata()
+	b64 := base64.StdEncoding.EncodeToString
+	url := base64.URLEncoding.EncodeToString
+
+	canonical := map[string]string{
+		names.Stamp:  meta.String(),
+		names.Size:   "6",
+		names.Time:   "1700000000",
+		names.MD5:    hex.EncodeToString(helloMD5[:]),
+		names.SHA1:   hex.EncodeToString(helloSHA1[:]),
+		names.SHA256: hex.EncodeToString(helloSHA256[:]),
+	}
+
+	partial := Partial{Size: 6, Time: 1700000000, Block: 4, SHA256: helloSHA256, OK: true}
+
+	type testCase struct {
+		Name   string
+		Input  map[string]string
+		Expect map[string]string
+		Stats  RewriteStats
+	}
+
+	testData := [...]testCase{
+		{
+			Name:   "already-canonical",
+			Input:  canonical,
+			Expect: canonical,
+		},
+		{
+			Name: "legacy-fields-without-stamp",
+			Input: map[string]string{
+				names.Size:   "6",
+				names.Time:   "1700000000",
+				names.MD5:    b64(helloMD5[:]),
+				names.SHA1:   string(helloSHA1[:]),
+				names.SHA256: url(helloSHA256[:]),
+			},
+			Expect: canonical,
+			Stats:  RewriteStats{Changed: 4},
+		},
+		{
+			Name: "non-canonical-stamp-only",
+			Input: map[string]string{
+				names.Stamp: "SHA256:" + hex.EncodeToString(helloSHA256[:]) +
+					",sha1:" + url(helloSHA1[:]) +
+					",md5:" + hex.EncodeToString(helloMD5[:]) +
+					",modTime:1700000000,size:6",
+			},
+			Expect: canonical,
+			Stats:  RewriteStats{Changed: 6},
+		},
+		{
+			Name: "malformed-field-is-replaced-from-stamp",
+			Input: map[string]string{
+				names.Stamp:  meta.String(),
+				names.Size:   "6",
+				names.Time:   "1700000000",
+				names.MD5:    "not a hash",
+				names.SHA1:   hex.EncodeToString(helloSHA1[:]),
+				names.SHA256: hex.EncodeToString(helloSHA256[:]),
+			},
+			Expect: canonical,
+			Stats:  RewriteStats{Changed: 1, Removed: 1},
+		},
+		{
+			Name: "malformed-field-without-stamp",
+			Input: map[string]string{
+				names.Size: "6",
+				names.MD5:  "not a hash",
+			},
+			Expect: map[string]string{
+				names.Size: "6",
+			},
+			Stats: RewriteStats{Removed: 1},
+		},
+		{
+			Name: "incomplete-stamp",
+			Input: map[string]string{
+				names.Stamp: "size:6,modTime:1700000000",
+				names.SHA1:  b64(helloSHA1[:]),
+			},
+			Expect: map[string]string{
+				names.SHA1: hex.EncodeToString(helloSHA1[:]),
+			},
+			Stats: RewriteStats{Changed: 1, Removed: 1},
+		},
+		{
+			Name: "partial-is-normalized",
+			Input: map[string]string{
+				names.Partial: "block:4,sha256:" + hex.EncodeToString(helloSHA256[:]) + ",size:6,modTime:1700000000",
+			},
+			Expect: map[string]string{
+				names.Partial: partial.String(),
+			},
+			Stats: RewriteStats{Changed: 1},
+		},
+		{
+			Name: "malformed-partial-is-removed",
+			Input: map[string]string{
+				names.Partial: "size:6,modTime:1700000000,sha256:" + hex.EncodeToString(helloSHA256[:]),
+			},
+			Expect: map[string]string{},
+			Stats:  RewriteStats{Removed: 1},
+		},
+	}
+
+	for _, row := range testData {
+		t.Run(row.Name, func(t *testing.T) {
+			f := xattrFile(t, row.Input)
+			stats := Rewrite(f, names)
+			if stats != row.Stats {
+				t.Errorf("Rewrite: wrong stats: expect %+v, got %+v", row.Stats, stats)
+			}
+			if actual := readXattrs(t, f); !reflect.DeepEqual(actual, row.Expect) {
+				t.Errorf("Rewrite: wrong xattrs\n\texpect: %q\n\tactual: %q", row.Expect, actual)
+			}
+		})
+	}
+}
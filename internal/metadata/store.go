@@ -0,0 +1,158 @@
+package metadata
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/chronos-tachyon/go-dedupe/internal/item"
+)
+
+type StoreKind string
+
+const (
+	XattrStoreKind    StoreKind = "xattr"
+	CacheStoreKind    StoreKind = "cache"
+	FallbackStoreKind StoreKind = "both"
+)
+
+var allStoreKinds = [...]StoreKind{
+	XattrStoreKind,
+	CacheStoreKind,
+	FallbackStoreKind,
+}
+
+func ParseStoreKind(input string) (StoreKind, error) {
+	for _, kind := range allStoreKinds {
+		if strings.EqualFold(input, string(kind)) {
+			return kind, nil
+		}
+	}
+	return "", fmt.Errorf("unknown metadata store %q", input)
+}
+
+func (kind StoreKind) String() string {
+	return string(kind)
+}
+
+var _ fmt.Stringer = StoreKind("")
+
+type Store interface {
+	Load(it *item.Item, meta *Metadata) bool
+	Save(it *item.Item, meta Metadata) bool
+	Close() error
+}
+
+type StoreOptions struct {
+	Kind      StoreKind
+	Names     Names
+	CachePath string
+	NoWrite   bool
+	CacheOnly bool
+}
+
+func (opts StoreOptions) WritesXattrs() bool {
+	return !opts.NoWrite && !opts.CacheOnly && opts.Kind != CacheStoreKind
+}
+
+func OpenStore(opts StoreOptions) (Store, error) {
+	if opts.NoWrite && opts.CacheOnly {
+		return nil, errors.New("read-only and cache-only modes are mutually exclusive")
+	}
+
+	var xa Store = XattrStore{Names: opts.Names}
+	if opts.NoWrite || opts.CacheOnly {
+		xa = ReadOnlyStore{Store: xa}
+	}
+
+	var cache Store
+	if opts.Kind != XattrStoreKind || opts.CacheOnly {
+		var err error
+		cache, err = OpenCacheStore(opts.CachePath)
+		if err != nil {
+			return nil, err
+		}
+		if opts.NoWrite {
+			cache = ReadOnlyStore{Store: cache}
+		}
+	}
+
+	switch opts.Kind {
+	case XattrStoreKind:
+		if opts.CacheOnly {
+			return FallbackStore{Primary: xa, Secondary: cache}, nil
+		}
+		return xa, nil
+	case CacheStoreKind:
+		return cache, nil
+	case FallbackStoreKind:
+		return FallbackStore{Primary: xa, Secondary: cache}, nil
+	default:
+		return nil, fmt.Errorf("unknown metadata store %q", opts.Kind)
+	}
+}
+
+type XattrStore struct {
+	Names Names
+}
+
+func (store XattrStore) Load(it *item.Item, meta *Metadata) bool {
+	return meta.Load(it.File, store.Names)
+}
+
+func (store XattrStore) Save(it *item.Item, meta Metadata) bool {
+	return meta.Save(it.File, store.Names)
+}
+
+func (store XattrStore) Close() error {
+	return nil
+}
+
+type FallbackStore struct {
+	Primary   Store
+	Secondary Store
+}
+
+func (store FallbackStore) Load(it *item.Item, meta *Metadata) bool {
+	if store.Primary.Load(it, meta) && meta.Check(it.Size, it.Time) {
+		return true
+	}
+	var alt Metadata
+	if store.Secondary.Load(it, &alt) {
+		*meta = alt
+		return true
+	}
+	return meta.Bits.HasAll(AllBits)
+}
+
+func (store FallbackStore) Save(it *item.Item, meta Metadata) bool {
+	if store.Primary.Save(it, meta) {
+		return true
+	}
+	return store.Secondary.Save(it, meta)
+}
+
+func (store FallbackStore) Close() error {
+	return errors.Join(store.Primary.Close(), store.Secondary.Close())
+}
+
+type ReadOnlyStore struct {
+	Store
+}
+
+func (store ReadOnlyStore) Save(it *item.Item, meta Metadata) bool {
+	return false
+}
+
+// Close discards any changes the wrapped store made in memory, such as stale
+// cache records dropped by Load, rather than writing them back.
+func (store ReadOnlyStore) Close() error {
+	return nil
+}
+
+var (
+	_ Store = XattrStore{}
+	_ Store = ReadOnlyStore{}
+	_ Store = FallbackStore{}
+	_ Store = (*CacheStore)(nil)
+)
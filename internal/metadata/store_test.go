@@ -0,0 +1,61 @@
+package metadata
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadOnlyStoreNeverWritesCache(t *testing.T) {
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "metadata.cache")
+	path := filepath.Join(dir, "file")
+	gonePath := filepath.Join(dir, "gone")
+
+	it := createFile(t, path, "hello\n")
+	gone := createFile(t, gonePath, "gone\n")
+	cache := openCache(t, cachePath)
+	cache.Save(it, testMetadata(it, 0x10))
+	cache.Save(gone, testMetadata(gone, 0x20))
+	if err := cache.Close(); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(gonePath); err != nil {
+		t.Fatal(err)
+	}
+	changed := createFile(t, path, "hello, world\n")
+
+	store, err := OpenStore(StoreOptions{
+		Kind:      CacheStoreKind,
+		Names:     DefaultNames(),
+		CachePath: cachePath,
+		NoWrite:   true,
+	})
+	if err != nil {
+		t.Fatalf("OpenStore: unexpected error: %v", err)
+	}
+	var meta Metadata
+	if store.Load(changed, &meta) {
+		t.Error("Load: expected a record for a changed file to be rejected")
+	}
+	if store.Save(changed, testMetadata(changed, 0x30)) {
+		t.Error("Save: expected a read-only store to refuse")
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close: unexpected error: %v", err)
+	}
+
+	after, err := os.ReadFile(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Errorf("Close: read-only store rewrote the cache\n\tbefore: %q\n\tafter:  %q", before, after)
+	}
+}
@@ -37,19 +37,19 @@ func MaybeFGet(file *os.File, name string) ([]byte, bool) {
 	return nil, false
 }
 
-func MaybeFSet(file *os.File, name string, value []byte) {
+func MaybeFSet(file *os.File, name string, value []byte) bool {
 	existing, err := xattr.FGet(file, name)
 	switch {
 	case err == nil:
 		if bytes.Equal(value, existing) {
-			return
+			return true
 		}
 	case errors.Is(err, xattr.ENOATTR):
 		// pass
 	case errors.Is(err, syscall.ENODATA):
 		// pass
 	default:
-		return
+		return false
 	}
 
 	err = xattr.FSet(file, name, value)
@@ -59,7 +59,7 @@ func MaybeFSet(file *os.File, name string, value []byte) {
 			Str("xaName", name).
 			Bytes("xaValue", value).
 			Msg("fsetxattr")
-		return
+		return true
 	}
 
 	log.Logger.Error().
@@ -68,4 +68,31 @@ func MaybeFSet(file *os.File, name string, value []byte) {
 		Bytes("xaValue", value).
 		Err(err).
 		Msg("fsetxattr failed")
+	return false
+}
+
+func MaybeFRemove(file *os.File, name string) bool {
+	err := xattr.FRemove(file, name)
+	if err == nil {
+		log.Logger.Debug().
+			Str("path", file.Name()).
+			Str("xaName", name).
+			Msg("fremovexattr")
+		return true
+	}
+
+	if errors.Is(err, xattr.ENOATTR) {
+		return true
+	}
+
+	if errors.Is(err, syscall.ENODATA) {
+		return true
+	}
+
+	log.Logger.Error().
+		Str("path", file.Name()).
+		Str("xaName", name).
+		Err(err).
+		Msg("fremovexattr failed")
+	return false
 }
@@ -0,0 +1,34 @@
+package pathutil
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Canonical returns the absolute form of path with all symlinks resolved.
+// If the path cannot be resolved, the absolute (or failing that, cleaned)
+// path is returned instead.
+func Canonical(path string) string {
+	path = filepath.Clean(path)
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if real, err := filepath.EvalSymlinks(abs); err == nil {
+		return real
+	}
+	return abs
+}
+
+// IsWithin reports whether path is dir or lies beneath it.  Both paths are
+// compared as strings, so they should already be canonical.
+func IsWithin(path string, dir string) bool {
+	if path == dir {
+		return true
+	}
+	if !strings.HasSuffix(dir, string(os.PathSeparator)) {
+		dir += string(os.PathSeparator)
+	}
+	return strings.HasPrefix(path, dir)
+}
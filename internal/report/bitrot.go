@@ -0,0 +1,47 @@
+package report
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+type BitrotFile struct {
+	Path         string   `json:"path"`
+	Links        []string `json:"links,omitempty"`
+	Dev          uint64   `json:"dev"`
+	Ino          uint64   `json:"ino"`
+	Size         int64    `json:"size"`
+	Time         int64    `json:"mtime"`
+	StoredSHA256 string   `json:"stored_sha256"`
+	ActualSHA256 string   `json:"actual_sha256"`
+}
+
+type BitrotWriter interface {
+	Write(file BitrotFile) error
+	Close() error
+	Abort() error
+}
+
+// NewBitrotWriter writes files whose contents no longer match their stored
+// hashes.  Only the JSON formats can represent them; json and rich are
+// equivalent here, as are ndjson and rich-ndjson.
+func NewBitrotWriter(w io.Writer, format Format) (BitrotWriter, error) {
+	bw := bufio.NewWriter(w)
+	switch format {
+	case FormatJSON, FormatRich:
+		return bitrotWriter{&jsonWriter{w: bw}}, nil
+	case FormatNDJSON, FormatRichNDJSON:
+		return bitrotWriter{&ndjsonWriter{w: bw}}, nil
+	default:
+		return nil, fmt.Errorf("format %q is not supported for bitrot reports", format)
+	}
+}
+
+type bitrotWriter struct {
+	elementWriter
+}
+
+func (bw bitrotWriter) Write(file BitrotFile) error {
+	return bw.writeElement(file)
+}
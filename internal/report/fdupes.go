@@ -0,0 +1,64 @@
+package report
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"regexp"
+)
+
+var reFdupesSize = regexp.MustCompile(`^[0-9]+ bytes? each:$`)
+
+// fdupesWriter holds its output until Close, since the format has no way to
+// mark a partial result and Abort must discard it instead.
+type fdupesWriter struct {
+	w   *bufio.Writer
+	buf bytes.Buffer
+}
+
+func (fw *fdupesWriter) Write(group Group) error {
+	for _, file := range group.Files {
+		_, _ = fw.buf.WriteString(file.Path)
+		_ = fw.buf.WriteByte('\n')
+	}
+	_ = fw.buf.WriteByte('\n')
+	return nil
+}
+
+func (fw *fdupesWriter) Close() error {
+	_, _ = fw.buf.WriteTo(fw.w)
+	return fw.w.Flush()
+}
+
+func (fw *fdupesWriter) Abort() error {
+	fw.buf.Reset()
+	return fw.w.Flush()
+}
+
+type fdupesReader struct {
+	s *bufio.Scanner
+}
+
+func (fr *fdupesReader) Read() (Group, error) {
+	var paths []string
+	for fr.s.Scan() {
+		line := fr.s.Text()
+		switch {
+		case line == "" && len(paths) > 0:
+			return GroupFromPaths(paths), nil
+		case line == "":
+			// pass
+		case len(paths) == 0 && reFdupesSize.MatchString(line):
+			// pass
+		default:
+			paths = append(paths, line)
+		}
+	}
+	if err := fr.s.Err(); err != nil {
+		return Group{}, err
+	}
+	if len(paths) > 0 {
+		return GroupFromPaths(paths), nil
+	}
+	return Group{}, io.EOF
+}
@@ -0,0 +1,166 @@
+package report
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrIncomplete is returned in place of io.EOF when the input says that the
+// run which wrote it was interrupted.  The groups read before it are valid.
+var ErrIncomplete = errors.New("input is incomplete; the run that wrote it was interrupted")
+
+type Reader interface {
+	Read() (Group, error)
+}
+
+func NewReader(r io.Reader, format Format) (Reader, error) {
+	br := bufio.NewReader(r)
+	if format == FormatAuto {
+		var err error
+		format, err = detect(br)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if format == FormatFdupes {
+		return &fdupesReader{s: bufio.NewScanner(br)}, nil
+	}
+
+	d := json.NewDecoder(br)
+	switch format {
+	case FormatJSON, FormatRich:
+		return &jsonReader{d: d}, nil
+	case FormatNDJSON, FormatRichNDJSON:
+		return &ndjsonReader{d: d}, nil
+	case FormatRmlint:
+		return &rmlintReader{d: d}, nil
+	default:
+		return nil, fmt.Errorf("format %q is not supported for input", format)
+	}
+}
+
+func detect(br *bufio.Reader) (Format, error) {
+	var prev byte
+	for n := 1; n <= br.Size(); n++ {
+		buf, err := br.Peek(n)
+		if len(buf) < n {
+			if err == io.EOF && prev == 0 {
+				return FormatNDJSON, nil
+			}
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return "", fmt.Errorf("failed to detect input format: %w", err)
+		}
+
+		ch := buf[n-1]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n':
+			continue
+		case prev == 0 && ch == '[':
+			prev = ch
+		case prev == 0 && ch == '{':
+			return FormatRichNDJSON, nil
+		case prev == 0:
+			return FormatFdupes, nil
+		case prev == '[' && (ch == '[' || ch == ']'):
+			return FormatJSON, nil
+		case prev == '[' && ch == '{':
+			more, _ := br.Peek(min(n+64, br.Size()))
+			if isRmlintKey(firstKey(more[n:])) {
+				return FormatRmlint, nil
+			}
+			return FormatRich, nil
+		case prev == '[' && ch == '"':
+			return FormatNDJSON, nil
+		default:
+			return "", fmt.Errorf("failed to detect input format: unexpected character %q", ch)
+		}
+	}
+	return "", fmt.Errorf("failed to detect input format: too much leading whitespace")
+}
+
+func firstKey(buf []byte) string {
+	buf = bytes.TrimLeft(buf, " \t\r\n")
+	if len(buf) <= 0 || buf[0] != '"' {
+		return ""
+	}
+	buf = buf[1:]
+	if i := bytes.IndexByte(buf, '"'); i >= 0 {
+		return string(buf[:i])
+	}
+	return ""
+}
+
+type jsonReader struct {
+	d       *json.Decoder
+	started bool
+}
+
+func (jr *jsonReader) Read() (Group, error) {
+	if !jr.started {
+		if err := expectDelim(jr.d, '['); err != nil {
+			return Group{}, err
+		}
+		jr.started = true
+	}
+
+	if !jr.d.More() {
+		if err := expectDelim(jr.d, ']'); err != nil {
+			return Group{}, err
+		}
+		return Group{}, io.EOF
+	}
+
+	return decodeElement(jr.d)
+}
+
+func expectDelim(d *json.Decoder, expect json.Delim) error {
+	token, err := d.Token()
+	if err != nil {
+		return err
+	}
+	if token != expect {
+		return fmt.Errorf("expected %q; got %v", expect, token)
+	}
+	return nil
+}
+
+type ndjsonReader struct {
+	d *json.Decoder
+}
+
+func (nr *ndjsonReader) Read() (Group, error) {
+	return decodeElement(nr.d)
+}
+
+func decodeElement(d *json.Decoder) (Group, error) {
+	var raw json.RawMessage
+	if err := d.Decode(&raw); err != nil {
+		return Group{}, err
+	}
+
+	raw = bytes.TrimLeft(raw, " \t\r\n")
+	if len(raw) > 0 && raw[0] == '{' {
+		var marker incompleteMarker
+		if err := json.Unmarshal(raw, &marker); err == nil && marker.Incomplete {
+			return Group{}, ErrIncomplete
+		}
+		var group Group
+		if err := json.Unmarshal(raw, &group); err != nil {
+			return Group{}, err
+		}
+		return group, nil
+	}
+
+	var paths []string
+	if err := json.Unmarshal(raw, &paths); err != nil {
+		return Group{}, err
+	}
+	return GroupFromPaths(paths), nil
+}
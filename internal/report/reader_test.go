@@ -0,0 +1,248 @@
+package report
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testGroups() []Group {
+	return []Group{
+		{
+			SHA256: strings.Repeat("ab", 32),
+			SHA1:   strings.Repeat("cd", 20),
+			MD5:    strings.Repeat("ef", 16),
+			Size:   6,
+			Wasted: 12,
+			Files: []File{
+				{Path: "/ref/a", Dev: 1, Ino: 10, Nlink: 1, Time: 1700000000, Ref: true},
+				{Path: "/data/a", Dev: 1, Ino: 11, Nlink: 2, Time: 1700000001},
+				{Path: "/data/a-link", Dev: 1, Ino: 11, Nlink: 2, Time: 1700000001, Linked: true},
+			},
+		},
+		{
+			SHA256: strings.Repeat("12", 32),
+			Size:   4096,
+			Wasted: 4096,
+			Dir:    true,
+			Files: []File{
+				{Path: "/data/dir with \"quotes\"", Dev: 2, Ino: 20, Nlink: 3, Time: 1700000002},
+				{Path: "/data/dir\ttab", Dev: 2, Ino: 21, Nlink: 3, Time: 1700000003},
+			},
+		},
+	}
+}
+
+// expectGroup returns what reading back group should give for a format that
+// only keeps some of its fields.
+func expectGroup(format Format, group Group, refs bool) Group {
+	switch format {
+	case FormatRich, FormatRichNDJSON:
+		return group
+	case FormatRmlint:
+		out := Group{SHA256: group.SHA256, Size: group.Size, Dir: group.Dir}
+		for _, file := range group.Files {
+			out.Files = append(out.Files, File{
+				Path: file.Path,
+				Dev:  file.Dev,
+				Ino:  file.Ino,
+				Time: file.Time,
+				Ref:  refs && file.Ref,
+			})
+		}
+		out.Wasted = out.Size * int64(len(out.Files)-1)
+		return out
+	default:
+		return GroupFromPaths(group.Paths())
+	}
+}
+
+func writeAll(t *testing.T, format Format, refs bool, groups []Group, abort bool) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, format, refs)
+	if err != nil {
+		t.Fatalf("NewWriter: unexpected error: %v", err)
+	}
+	for _, group := range groups {
+		if err := w.Write(group); err != nil {
+			t.Fatalf("Write: unexpected error: %v", err)
+		}
+	}
+	if abort {
+		err = w.Abort()
+	} else {
+		err = w.Close()
+	}
+	if err != nil {
+		t.Fatalf("Close: unexpected error: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func readAll(t *testing.T, raw []byte) ([]Group, error) {
+	t.Helper()
+	r, err := NewReader(bytes.NewReader(raw), FormatAuto)
+	if err != nil {
+		return nil, err
+	}
+	var out []Group
+	for {
+		group, err := r.Read()
+		if err != nil {
+			return out, err
+		}
+		out = append(out, group)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	type testCase struct {
+		Format Format
+		Refs   bool
+	}
+
+	testData := [...]testCase{
+		{Format: FormatJSON},
+		{Format: FormatNDJSON},
+		{Format: FormatRich},
+		{Format: FormatRichNDJSON},
+		{Format: FormatFdupes},
+		{Format: FormatRmlint},
+		{Format: FormatRmlint, Refs: true},
+	}
+
+	for _, row := range testData {
+		name := row.Format.String()
+		if row.Refs {
+			name += "-refs"
+		}
+		t.Run(name, func(t *testing.T) {
+			groups := testGroups()
+			if row.Format == FormatFdupes {
+				// fdupes has one path per line.
+				groups[1].Files[1].Path = "/data/dir tab"
+			}
+			raw := writeAll(t, row.Format, row.Refs, groups, false)
+
+			detected, err := detect(bufio.NewReader(bytes.NewReader(raw)))
+			if err != nil {
+				t.Fatalf("detect: unexpected error: %v", err)
+			}
+			if detected != row.Format {
+				t.Errorf("detect: expected %q, got %q", row.Format, detected)
+			}
+
+			actual, err := readAll(t, raw)
+			if err != io.EOF {
+				t.Fatalf("Read: expected io.EOF, got %v", err)
+			}
+			expect := make([]Group, len(groups))
+			for i, group := range groups {
+				expect[i] = expectGroup(row.Format, group, row.Refs)
+			}
+			if !reflect.DeepEqual(actual, expect) {
+				t.Errorf("Read: wrong result\n\texpect: %+v\n\tactual: %+v\n\tinput:\n%s", expect, actual, raw)
+			}
+		})
+	}
+}
+
+func TestRoundTripEmpty(t *testing.T) {
+	for _, format := range [...]Format{FormatJSON, FormatNDJSON, FormatRich, FormatRichNDJSON, FormatFdupes, FormatRmlint} {
+		t.Run(format.String(), func(t *testing.T) {
+			raw := writeAll(t, format, false, nil, false)
+			actual, err := readAll(t, raw)
+			if err != io.EOF {
+				t.Fatalf("Read: expected io.EOF, got %v\n\tinput:\n%s", err, raw)
+			}
+			if len(actual) != 0 {
+				t.Errorf("Read: expected no groups, got %+v", actual)
+			}
+		})
+	}
+}
+
+func TestRoundTripAborted(t *testing.T) {
+	type testCase struct {
+		Format Format
+		Expect func(error) bool
+	}
+
+	isIncomplete := func(err error) bool { return err == ErrIncomplete }
+	isBroken := func(err error) bool { return err != nil && err != io.EOF && err != ErrIncomplete }
+
+	testData := [...]testCase{
+		{Format: FormatJSON, Expect: isBroken},
+		{Format: FormatNDJSON, Expect: isBroken},
+		{Format: FormatRich, Expect: isIncomplete},
+		{Format: FormatRichNDJSON, Expect: isIncomplete},
+		{Format: FormatRmlint, Expect: isIncomplete},
+	}
+
+	for _, row := range testData {
+		t.Run(row.Format.String(), func(t *testing.T) {
+			for _, groups := range [...][]Group{nil, testGroups()[:1]} {
+				raw := writeAll(t, row.Format, false, groups, true)
+				actual, err := readAll(t, raw)
+				if !row.Expect(err) {
+					t.Errorf("Read: wrong final error %v\n\tinput:\n%s", err, raw)
+				}
+				if err == ErrIncomplete && len(actual) != len(groups) {
+					t.Errorf("Read: expected the %d groups before the marker, got %+v", len(groups), actual)
+				}
+			}
+		})
+	}
+
+	t.Run("bare-ndjson-keeps-earlier-groups", func(t *testing.T) {
+		raw := writeAll(t, FormatNDJSON, false, testGroups(), true)
+		actual, err := readAll(t, raw)
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("Read: expected io.ErrUnexpectedEOF, got %v", err)
+		}
+		if len(actual) != 2 {
+			t.Errorf("Read: expected 2 groups before the cut, got %+v", actual)
+		}
+	})
+
+	t.Run("fdupes-writes-nothing", func(t *testing.T) {
+		raw := writeAll(t, FormatFdupes, false, testGroups(), true)
+		if len(raw) != 0 {
+			t.Errorf("Abort: expected no output, got %q", raw)
+		}
+	})
+}
+
+func TestRmlintRefs(t *testing.T) {
+	groups := testGroups()[:1]
+
+	raw := writeAll(t, FormatRmlint, false, groups, false)
+	if bytes.Contains(raw, []byte(`"refs"`)) {
+		t.Errorf("NewWriter: expected no refs key without refs\n%s", raw)
+	}
+	if n := bytes.Count(raw, []byte(`"is_original":true`)); n != 1 {
+		t.Errorf("Write: expected only the first file to be original, got %d\n%s", n, raw)
+	}
+
+	raw = writeAll(t, FormatRmlint, true, groups, false)
+	if !bytes.Contains(raw, []byte(`"generator":"go-dedupe","refs":true`)) {
+		t.Errorf("NewWriter: expected the header to claim refs\n%s", raw)
+	}
+
+	// A foreign header is not trusted to use is_original for references.
+	foreign := bytes.Replace(raw, []byte(`"generator":"go-dedupe",`), nil, 1)
+	actual, err := readAll(t, foreign)
+	if err != io.EOF {
+		t.Fatalf("Read: expected io.EOF, got %v", err)
+	}
+	for _, file := range actual[0].Files {
+		if file.Ref {
+			t.Errorf("Read: %q should not be a reference without the go-dedupe header", file.Path)
+		}
+	}
+}
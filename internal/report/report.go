@@ -0,0 +1,114 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Format string
+
+const (
+	FormatAuto       Format = "auto"
+	FormatJSON       Format = "json"
+	FormatNDJSON     Format = "ndjson"
+	FormatRich       Format = "rich"
+	FormatRichNDJSON Format = "rich-ndjson"
+	FormatFdupes     Format = "fdupes"
+	FormatRmlint     Format = "rmlint"
+)
+
+var allFormats = [...]Format{
+	FormatAuto,
+	FormatJSON,
+	FormatNDJSON,
+	FormatRich,
+	FormatRichNDJSON,
+	FormatFdupes,
+	FormatRmlint,
+}
+
+var formatAliases = map[string]Format{
+	"jdupes": FormatFdupes,
+}
+
+func ParseFormat(input string) (Format, error) {
+	if format, found := formatAliases[strings.ToLower(input)]; found {
+		return format, nil
+	}
+	for _, format := range allFormats {
+		if strings.EqualFold(input, string(format)) {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unknown format %q", input)
+}
+
+func (format Format) Streaming() bool {
+	switch format {
+	case FormatNDJSON:
+		return true
+	case FormatRichNDJSON:
+		return true
+	case FormatFdupes:
+		return true
+	default:
+		return false
+	}
+}
+
+// Annotated reports whether the format records per-group and per-file flags
+// such as Group.Dir and File.Ref, rather than only the paths.
+func (format Format) Annotated() bool {
+	switch format {
+	case FormatRich:
+		return true
+	case FormatRichNDJSON:
+		return true
+	case FormatRmlint:
+		return true
+	default:
+		return false
+	}
+}
+
+func (format Format) String() string {
+	return string(format)
+}
+
+var _ fmt.Stringer = Format("")
+
+type File struct {
+	Path   string `json:"path"`
+	Dev    uint64 `json:"dev"`
+	Ino    uint64 `json:"ino"`
+	Nlink  uint64 `json:"nlink"`
+	Time   int64  `json:"mtime"`
+	Linked bool   `json:"linked,omitempty"`
+	Ref    bool   `json:"ref,omitempty"`
+}
+
+type Group struct {
+	SHA256 string `json:"sha256,omitempty"`
+	SHA1   string `json:"sha1,omitempty"`
+	MD5    string `json:"md5,omitempty"`
+	Size   int64  `json:"size"`
+	Wasted int64  `json:"wasted"`
+	Dir    bool   `json:"dir,omitempty"`
+	Files  []File `json:"files"`
+}
+
+func (group Group) Paths() []string {
+	paths := make([]string, len(group.Files))
+	for i, file := range group.Files {
+		paths[i] = file.Path
+	}
+	return paths
+}
+
+func GroupFromPaths(paths []string) Group {
+	files := make([]File, len(paths))
+	for i, path := range paths {
+		files[i] = File{Path: path}
+	}
+	return Group{Files: files}
+}
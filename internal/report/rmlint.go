@@ -0,0 +1,250 @@
+package report
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	rmlintDescription  = "rmlint json-dump of lint files"
+	rmlintDuplicate    = "duplicate_file"
+	rmlintDuplicateDir = "duplicate_dir"
+	rmlintGenerator    = "go-dedupe"
+)
+
+var rmlintKeys = map[string]struct{}{
+	"description": {},
+	"id":          {},
+	"type":        {},
+	"aborted":     {},
+}
+
+func isRmlintKey(key string) bool {
+	_, found := rmlintKeys[key]
+	return found
+}
+
+type rmlintHeader struct {
+	Description  string `json:"description"`
+	Cwd          string `json:"cwd"`
+	Args         string `json:"args"`
+	Progress     int    `json:"progress"`
+	ChecksumType string `json:"checksum_type"`
+	Generator    string `json:"generator,omitempty"`
+	Refs         bool   `json:"refs,omitempty"`
+}
+
+type rmlintEntry struct {
+	ID           uint64  `json:"id"`
+	Type         string  `json:"type"`
+	Progress     int     `json:"progress"`
+	Checksum     string  `json:"checksum"`
+	Path         string  `json:"path"`
+	Size         int64   `json:"size"`
+	Inode        uint64  `json:"inode"`
+	DiskID       uint64  `json:"disk_id"`
+	IsOriginal   bool    `json:"is_original"`
+	Mtime        float64 `json:"mtime"`
+	ChecksumType string  `json:"checksum_type,omitempty"`
+}
+
+type rmlintFooter struct {
+	Aborted       bool   `json:"aborted"`
+	Progress      int    `json:"progress"`
+	TotalFiles    uint64 `json:"total_files"`
+	IgnoredFiles  uint64 `json:"ignored_files"`
+	IgnoredDirs   uint64 `json:"ignored_folders"`
+	Duplicates    uint64 `json:"duplicates"`
+	DuplicateSets uint64 `json:"duplicate_sets"`
+	TotalLintSize int64  `json:"total_lint_size"`
+}
+
+type rmlintWriter struct {
+	w      *bufio.Writer
+	footer rmlintFooter
+	nextID uint64
+	refs   bool
+}
+
+func newRmlintWriter(w *bufio.Writer, refs bool) *rmlintWriter {
+	cwd, _ := os.Getwd()
+	rw := &rmlintWriter{w: w, nextID: 1, refs: refs}
+	rw.writeElement(rmlintHeader{
+		Description:  rmlintDescription,
+		Cwd:          cwd,
+		Args:         strings.Join(os.Args, " "),
+		ChecksumType: "sha256",
+		Generator:    rmlintGenerator,
+		Refs:         refs,
+	}, "[\n")
+	return rw
+}
+
+func (rw *rmlintWriter) writeElement(v any, prefix string) error {
+	raw, err := marshal(v, "", "")
+	if err != nil {
+		return err
+	}
+	_, _ = rw.w.WriteString(prefix)
+	_, _ = rw.w.Write(raw)
+	return nil
+}
+
+func (rw *rmlintWriter) Write(group Group) error {
+	entryType := rmlintDuplicate
+	if group.Dir {
+		entryType = rmlintDuplicateDir
+	}
+	for i, file := range group.Files {
+		isOriginal := i == 0
+		if rw.refs {
+			isOriginal = file.Ref
+		}
+		entry := rmlintEntry{
+			ID:         rw.nextID,
+			Type:       entryType,
+			Progress:   100,
+			Checksum:   group.SHA256,
+			Path:       file.Path,
+			Size:       group.Size,
+			Inode:      file.Ino,
+			DiskID:     file.Dev,
+			IsOriginal: isOriginal,
+			Mtime:      float64(file.Time),
+		}
+		if err := rw.writeElement(entry, ",\n"); err != nil {
+			return err
+		}
+		rw.nextID++
+	}
+	rw.footer.TotalFiles += uint64(len(group.Files))
+	rw.footer.Duplicates += uint64(len(group.Files) - 1)
+	rw.footer.DuplicateSets++
+	rw.footer.TotalLintSize += group.Wasted
+	return rw.w.Flush()
+}
+
+func (rw *rmlintWriter) Close() error {
+	rw.footer.Progress = 100
+	return rw.finish()
+}
+
+func (rw *rmlintWriter) Abort() error {
+	rw.footer.Aborted = true
+	return rw.finish()
+}
+
+func (rw *rmlintWriter) finish() error {
+	if err := rw.writeElement(rw.footer, ",\n"); err != nil {
+		return err
+	}
+	_, _ = rw.w.WriteString("\n]\n")
+	return rw.w.Flush()
+}
+
+type rmlintReader struct {
+	d        *json.Decoder
+	started  bool
+	done     bool
+	checksum string
+	refs     bool
+	aborted  bool
+	pending  *rmlintEntry
+}
+
+func (rr *rmlintReader) next() (*rmlintEntry, error) {
+	if rr.done && rr.aborted {
+		return nil, ErrIncomplete
+	}
+	if rr.done {
+		return nil, io.EOF
+	}
+	if !rr.started {
+		if err := expectDelim(rr.d, '['); err != nil {
+			return nil, err
+		}
+		rr.started = true
+	}
+
+	for rr.d.More() {
+		var raw json.RawMessage
+		if err := rr.d.Decode(&raw); err != nil {
+			return nil, err
+		}
+		var entry rmlintEntry
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return nil, err
+		}
+		if entry.Type == "" {
+			var header rmlintHeader
+			if err := json.Unmarshal(raw, &header); err == nil && header.Description == rmlintDescription {
+				rr.refs = header.Generator == rmlintGenerator && header.Refs
+			}
+			var footer rmlintFooter
+			if err := json.Unmarshal(raw, &footer); err == nil && footer.Aborted {
+				rr.aborted = true
+			}
+		}
+		if entry.ChecksumType != "" {
+			rr.checksum = entry.ChecksumType
+		}
+		if entry.Type == rmlintDuplicate || entry.Type == rmlintDuplicateDir {
+			return &entry, nil
+		}
+	}
+
+	if err := expectDelim(rr.d, ']'); err != nil {
+		return nil, err
+	}
+	rr.done = true
+	return rr.next()
+}
+
+func (rr *rmlintReader) Read() (Group, error) {
+	first := rr.pending
+	rr.pending = nil
+	if first == nil {
+		var err error
+		first, err = rr.next()
+		if err != nil {
+			return Group{}, err
+		}
+	}
+
+	var group Group
+	group.Size = first.Size
+	group.Dir = first.Type == rmlintDuplicateDir
+	if rr.checksum == "sha256" {
+		group.SHA256 = first.Checksum
+	}
+
+	entry := first
+	for {
+		group.Files = append(group.Files, File{
+			Path: entry.Path,
+			Dev:  entry.DiskID,
+			Ino:  entry.Inode,
+			Time: int64(entry.Mtime),
+			Ref:  rr.refs && entry.IsOriginal,
+		})
+
+		var err error
+		entry, err = rr.next()
+		if err == io.EOF || err == ErrIncomplete {
+			break
+		}
+		if err != nil {
+			return Group{}, err
+		}
+		if entry.Checksum != first.Checksum || entry.Size != first.Size || entry.Type != first.Type {
+			rr.pending = entry
+			break
+		}
+	}
+
+	group.Wasted = group.Size * int64(len(group.Files)-1)
+	return group, nil
+}
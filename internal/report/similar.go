@@ -0,0 +1,55 @@
+package report
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+type SimilarFile struct {
+	Path string `json:"path"`
+	Dev  uint64 `json:"dev"`
+	Ino  uint64 `json:"ino"`
+	Size int64  `json:"size"`
+}
+
+type Pair struct {
+	Files  [2]SimilarFile `json:"files"`
+	Shared int64          `json:"shared"`
+	Ratio  float64        `json:"ratio"`
+}
+
+type PairWriter interface {
+	Write(pair Pair) error
+	Close() error
+	Abort() error
+}
+
+type elementWriter interface {
+	writeElement(v any) error
+	Close() error
+	Abort() error
+}
+
+// NewPairWriter writes similar file pairs.  Only the JSON formats can
+// represent them; json and rich are equivalent here, as are ndjson and
+// rich-ndjson.
+func NewPairWriter(w io.Writer, format Format) (PairWriter, error) {
+	bw := bufio.NewWriter(w)
+	switch format {
+	case FormatJSON, FormatRich:
+		return pairWriter{&jsonWriter{w: bw}}, nil
+	case FormatNDJSON, FormatRichNDJSON:
+		return pairWriter{&ndjsonWriter{w: bw}}, nil
+	default:
+		return nil, fmt.Errorf("format %q is not supported for similar file pairs", format)
+	}
+}
+
+type pairWriter struct {
+	elementWriter
+}
+
+func (pw pairWriter) Write(pair Pair) error {
+	return pw.writeElement(pair)
+}
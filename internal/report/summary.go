@@ -0,0 +1,54 @@
+package report
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+type Summary struct {
+	Groups           int            `json:"groups"`
+	Files            int            `json:"files"`
+	DuplicateFiles   int            `json:"duplicate_files"`
+	HardlinkedFiles  int            `json:"hardlinked_files"`
+	WastedBytes      int64          `json:"wasted_bytes"`
+	ReclaimableBytes int64          `json:"reclaimable_bytes"`
+	TopDirectories   []SummaryEntry `json:"top_directories"`
+	TopExtensions    []SummaryEntry `json:"top_extensions"`
+	Incomplete       bool           `json:"incomplete,omitempty"`
+}
+
+type SummaryEntry struct {
+	Name             string `json:"name"`
+	Files            int    `json:"files"`
+	WastedBytes      int64  `json:"wasted_bytes"`
+	ReclaimableBytes int64  `json:"reclaimable_bytes"`
+}
+
+type SummaryWriter struct {
+	w      *bufio.Writer
+	indent string
+}
+
+func NewSummaryWriter(w io.Writer, format Format) (*SummaryWriter, error) {
+	sw := &SummaryWriter{w: bufio.NewWriter(w)}
+	switch format {
+	case FormatJSON, FormatRich:
+		sw.indent = "  "
+	case FormatNDJSON, FormatRichNDJSON:
+		// pass
+	default:
+		return nil, fmt.Errorf("format %q is not supported for summaries", format)
+	}
+	return sw, nil
+}
+
+func (sw *SummaryWriter) Write(summary Summary) error {
+	raw, err := marshal(summary, "", sw.indent)
+	if err != nil {
+		return err
+	}
+	_, _ = sw.w.Write(raw)
+	_ = sw.w.WriteByte('\n')
+	return sw.w.Flush()
+}
@@ -0,0 +1,78 @@
+package report
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+type UniqueFile struct {
+	Path  string `json:"path"`
+	Dev   uint64 `json:"dev"`
+	Ino   uint64 `json:"ino"`
+	Nlink uint64 `json:"nlink"`
+	Size  int64  `json:"size"`
+	Time  int64  `json:"mtime"`
+}
+
+type UniqueWriter interface {
+	Write(file UniqueFile) error
+	Close() error
+	Abort() error
+}
+
+// NewUniqueWriter writes a list of files.  The json and ndjson formats list
+// bare paths, rich and rich-ndjson list objects, and fdupes lists one path
+// per line.
+func NewUniqueWriter(w io.Writer, format Format) (UniqueWriter, error) {
+	bw := bufio.NewWriter(w)
+	switch format {
+	case FormatJSON:
+		return uniqueWriter{elementWriter: &jsonWriter{w: bw}}, nil
+	case FormatNDJSON:
+		return uniqueWriter{elementWriter: &ndjsonWriter{w: bw}}, nil
+	case FormatRich:
+		return uniqueWriter{elementWriter: &jsonWriter{w: bw}, rich: true}, nil
+	case FormatRichNDJSON:
+		return uniqueWriter{elementWriter: &ndjsonWriter{w: bw}, rich: true}, nil
+	case FormatFdupes:
+		return uniqueLineWriter{w: bw, buf: new(bytes.Buffer)}, nil
+	default:
+		return nil, fmt.Errorf("format %q is not supported for unique file lists", format)
+	}
+}
+
+type uniqueWriter struct {
+	elementWriter
+	rich bool
+}
+
+func (uw uniqueWriter) Write(file UniqueFile) error {
+	if uw.rich {
+		return uw.writeElement(file)
+	}
+	return uw.writeElement(file.Path)
+}
+
+// uniqueLineWriter holds its output until Close, for the same reason as
+// fdupesWriter.
+type uniqueLineWriter struct {
+	w   *bufio.Writer
+	buf *bytes.Buffer
+}
+
+func (lw uniqueLineWriter) Write(file UniqueFile) error {
+	_, _ = lw.buf.WriteString(file.Path)
+	return lw.buf.WriteByte('\n')
+}
+
+func (lw uniqueLineWriter) Close() error {
+	_, _ = lw.buf.WriteTo(lw.w)
+	return lw.w.Flush()
+}
+
+func (lw uniqueLineWriter) Abort() error {
+	lw.buf.Reset()
+	return lw.w.Flush()
+}
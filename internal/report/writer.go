@@ -0,0 +1,157 @@
+package report
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+type Writer interface {
+	Write(group Group) error
+	Close() error
+
+	// Abort is like Close, but marks the output as incomplete.  The rich
+	// formats end with an {"incomplete":true} element and rmlint sets
+	// "aborted" in its footer; readers report either as ErrIncomplete.
+	// The bare json and ndjson formats end with that element cut short, so
+	// that any JSON parser fails rather than trusting a partial result.
+	// The fdupes format has no way to mark it, so nothing is written.
+	Abort() error
+}
+
+// NewWriter returns a Writer for the given format.  If refs is true, the
+// rmlint format uses is_original to mark reference files, and only them.
+func NewWriter(w io.Writer, format Format, refs bool) (Writer, error) {
+	bw := bufio.NewWriter(w)
+	switch format {
+	case FormatJSON:
+		return &jsonWriter{w: bw}, nil
+	case FormatNDJSON:
+		return &ndjsonWriter{w: bw}, nil
+	case FormatRich:
+		return &jsonWriter{w: bw, rich: true}, nil
+	case FormatRichNDJSON:
+		return &ndjsonWriter{w: bw, rich: true}, nil
+	case FormatFdupes:
+		return &fdupesWriter{w: bw}, nil
+	case FormatRmlint:
+		return newRmlintWriter(bw, refs), nil
+	default:
+		return nil, fmt.Errorf("format %q is not supported for output", format)
+	}
+}
+
+type jsonWriter struct {
+	w     *bufio.Writer
+	count uint
+	rich  bool
+}
+
+func (jw *jsonWriter) Write(group Group) error {
+	return jw.writeElement(element(group, jw.rich))
+}
+
+func (jw *jsonWriter) writeElement(v any) error {
+	raw, err := marshal(v, "  ", "  ")
+	if err != nil {
+		return err
+	}
+	if jw.count == 0 {
+		_, _ = jw.w.WriteString("[\n  ")
+	} else {
+		_, _ = jw.w.WriteString(",\n  ")
+	}
+	_, _ = jw.w.Write(raw)
+	jw.count++
+	return nil
+}
+
+func (jw *jsonWriter) Close() error {
+	if jw.count == 0 {
+		_, _ = jw.w.WriteString("[]\n")
+	} else {
+		_, _ = jw.w.WriteString("\n]\n")
+	}
+	return jw.w.Flush()
+}
+
+func (jw *jsonWriter) Abort() error {
+	if jw.rich {
+		if err := jw.writeElement(incompleteMarker{Incomplete: true}); err != nil {
+			return err
+		}
+		return jw.Close()
+	}
+	if jw.count == 0 {
+		_, _ = jw.w.WriteString("[\n  ")
+	} else {
+		_, _ = jw.w.WriteString(",\n  ")
+	}
+	_, _ = jw.w.WriteString(unterminatedMarker)
+	return jw.w.Flush()
+}
+
+type ndjsonWriter struct {
+	w    *bufio.Writer
+	rich bool
+}
+
+func (nw *ndjsonWriter) Write(group Group) error {
+	return nw.writeElement(element(group, nw.rich))
+}
+
+func (nw *ndjsonWriter) writeElement(v any) error {
+	raw, err := marshal(v, "", "")
+	if err != nil {
+		return err
+	}
+	_, _ = nw.w.Write(raw)
+	_ = nw.w.WriteByte('\n')
+	return nw.w.Flush()
+}
+
+func (nw *ndjsonWriter) Close() error {
+	return nw.w.Flush()
+}
+
+func (nw *ndjsonWriter) Abort() error {
+	if nw.rich {
+		if err := nw.writeElement(incompleteMarker{Incomplete: true}); err != nil {
+			return err
+		}
+		return nw.Close()
+	}
+	_, _ = nw.w.WriteString(unterminatedMarker)
+	return nw.w.Flush()
+}
+
+// incompleteMarker is the last element written by an aborted rich writer.
+type incompleteMarker struct {
+	Incomplete bool `json:"incomplete"`
+}
+
+// unterminatedMarker ends aborted bare JSON output.  It is deliberately cut
+// short, so that the output as a whole no longer parses.
+const unterminatedMarker = `{"incomplete":true`
+
+func element(group Group, rich bool) any {
+	if rich {
+		return group
+	}
+	return group.Paths()
+}
+
+func marshal(v any, prefix string, indent string) ([]byte, error) {
+	var buf bytes.Buffer
+	e := json.NewEncoder(&buf)
+	e.SetEscapeHTML(false)
+	if indent != "" {
+		e.SetIndent(prefix, indent)
+	}
+	if err := e.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
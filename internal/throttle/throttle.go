@@ -0,0 +1,122 @@
+package throttle
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	gLimiter   *Limiter
+	gDropCache bool
+)
+
+// SetMaxReadRate limits the combined read bandwidth of every Reader in the
+// process.  A rate of zero or less removes the limit.
+func SetMaxReadRate(bytesPerSecond int64) {
+	gLimiter = NewLimiter(bytesPerSecond)
+}
+
+// SetDropCache controls whether DropCache evicts a file's pages.
+func SetDropCache(value bool) {
+	gDropCache = value
+}
+
+func NewReader(r io.Reader) io.Reader {
+	if gLimiter == nil {
+		return r
+	}
+	return &reader{r: r, limiter: gLimiter}
+}
+
+type reader struct {
+	r       io.Reader
+	limiter *Limiter
+}
+
+func (tr *reader) Read(p []byte) (int, error) {
+	n, err := tr.r.Read(p)
+	tr.limiter.Wait(n)
+	return n, err
+}
+
+func Sequential(file *os.File) {
+	_ = fadvise(file, adviceSequential)
+}
+
+func DropCache(file *os.File) {
+	if gDropCache {
+		_ = fadvise(file, adviceDontNeed)
+	}
+}
+
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func NewLimiter(bytesPerSecond int64) *Limiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	rate := float64(bytesPerSecond)
+	burst := max(rate/10, 1<<16)
+	return &Limiter{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+func (l *Limiter) Wait(n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	time.Sleep(delay)
+}
+
+var rateSuffixes = []struct {
+	suffix string
+	scale  int64
+}{
+	{"K", 1 << 10},
+	{"M", 1 << 20},
+	{"G", 1 << 30},
+	{"T", 1 << 40},
+}
+
+// ParseRate parses a byte count with an optional K, M, G, or T suffix
+// (powers of 1024, optionally followed by "iB" or "B").
+func ParseRate(in string) (int64, error) {
+	str := strings.TrimSpace(in)
+	str = strings.TrimSuffix(str, "B")
+	str = strings.TrimSuffix(str, "i")
+	scale := int64(1)
+	for _, row := range rateSuffixes {
+		if rest, found := strings.CutSuffix(strings.ToUpper(str), row.suffix); found {
+			str = str[:len(rest)]
+			scale = row.scale
+			break
+		}
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid rate %q", in)
+	}
+	return int64(value * float64(scale)), nil
+}
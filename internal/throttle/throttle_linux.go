@@ -0,0 +1,89 @@
+//go:build linux
+
+package throttle
+
+import (
+	"errors"
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	adviceSequential = unix.FADV_SEQUENTIAL
+	adviceDontNeed   = unix.FADV_DONTNEED
+)
+
+const (
+	ioprioWhoProcess = 1
+	ioprioClassIdle  = 3
+	ioprioClassShift = 13
+)
+
+func fadvise(file *os.File, advice int) error {
+	return unix.Fadvise(int(file.Fd()), 0, 0, advice)
+}
+
+// SetIdlePriority moves the process into the idle I/O scheduling class, so
+// that its disk reads are only serviced when no one else needs the disk.
+//
+// Linux tracks I/O priority per thread, so the class is applied to every
+// thread the runtime has started so far.  Threads started later are cloned
+// from one of these and inherit it.  The thread list is re-read until it
+// stops changing, to catch threads cloned while it was being walked.
+func SetIdlePriority() error {
+	done := make(map[int]struct{})
+	for {
+		tids, err := threadIDs()
+		if err != nil {
+			return err
+		}
+		changed := false
+		for _, tid := range tids {
+			if _, found := done[tid]; found {
+				continue
+			}
+			done[tid] = struct{}{}
+			changed = true
+			err := ioprioSet(tid, ioprioClassIdle<<ioprioClassShift)
+			if err != nil && !errors.Is(err, unix.ESRCH) {
+				return err
+			}
+		}
+		if !changed {
+			return nil
+		}
+	}
+}
+
+func threadIDs() ([]int, error) {
+	names, err := readDirNames("/proc/self/task")
+	if err != nil {
+		return nil, err
+	}
+	tids := make([]int, 0, len(names))
+	for _, name := range names {
+		if tid, err := strconv.Atoi(name); err == nil {
+			tids = append(tids, tid)
+		}
+	}
+	return tids, nil
+}
+
+func readDirNames(path string) ([]string, error) {
+	dir, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+	return dir.Readdirnames(-1)
+}
+
+func ioprioSet(tid int, prio int) error {
+	_, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), uintptr(prio))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package throttle
+
+import (
+	"errors"
+	"os"
+)
+
+const (
+	adviceSequential = 0
+	adviceDontNeed   = 0
+)
+
+func fadvise(file *os.File, advice int) error {
+	return nil
+}
+
+func SetIdlePriority() error {
+	return errors.New("I/O priority classes are not supported on this platform")
+}